@@ -0,0 +1,223 @@
+package cli
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/jdockerty/kubectl-oomd/pkg/plugin"
+	"github.com/spf13/cobra"
+	"k8s.io/client-go/kubernetes"
+)
+
+var (
+
+	// Provides the `--factor` flag, multiplying the current memory limits rather
+	// than using the recommended limits.
+	fixFactor float64
+
+	// Provides the `--patch-type` flag, either `strategic` or `json`.
+	patchType string
+
+	// Provides the `--dry-run` flag, either `client` to only print the patches or
+	// `server` to also validate them with the API server.
+	fixDryRun string
+
+	// Provides the `--apply` flag, applying the patches after confirmation.
+	applyFixes bool
+)
+
+const (
+	dryRunClient = "client"
+	dryRunServer = "server"
+)
+
+func fixCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "fix [TYPE/NAME ...]",
+		Short: "Raise the memory limits of workloads with OOMKilled containers",
+		Long: `Generate patches which raise the memory limit of each container which was terminated by Kubernetes
+due to an 'Out Of Memory' error, on the Deployment, StatefulSet, DaemonSet or CronJob which owns its pod.
+
+The limit is raised to the same limit as 'kubectl oomd recommend', or by '--factor' when it is given. Containers
+without a memory limit are skipped, as a new limit could be below their request.
+
+By default, the patches are only printed as 'kubectl patch' commands. Use '--dry-run=server' to validate them
+with the API server without changing anything, or '--apply' to apply them after confirmation.`,
+		Args:          cobra.ArbitraryArgs,
+		SilenceErrors: true,
+		SilenceUsage:  true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+
+			out := cmd.OutOrStdout()
+
+			if fixFactor != 0 && fixFactor <= 1 {
+				return fmt.Errorf("invalid --factor %g, must be greater than 1", fixFactor)
+			}
+
+			if err := validateRecommendFlags(); err != nil {
+				return err
+			}
+
+			if fixDryRun != dryRunClient && fixDryRun != dryRunServer {
+				return fmt.Errorf("invalid --dry-run %q, must be %s or %s", fixDryRun, dryRunClient, dryRunServer)
+			}
+
+			if applyFixes && cmd.Flags().Changed("dry-run") {
+				return fmt.Errorf("--apply cannot be used with --dry-run")
+			}
+
+			factory := newClientFactory(KubernetesConfigFlags)
+
+			opts, err := buildOptions(factory, args)
+			if err != nil {
+				return err
+			}
+			opts.MemoryUsage = true
+
+			// The patches are made to the workload which owns each pod.
+			if opts.Owners, err = plugin.NewOwnerResolver(factory); err != nil {
+				return err
+			}
+
+			if prometheusURL != "" {
+				opts.Prometheus, err = plugin.NewPrometheus(plugin.PrometheusOptions{URL: prometheusURL, Query: prometheusQuery})
+				if err != nil {
+					return err
+				}
+			}
+
+			oomPods, err := plugin.Run(cmd.Context(), factory, opts)
+			if err != nil {
+				return err
+			}
+
+			client, err := factory.KubernetesClient()
+			if err != nil {
+				return err
+			}
+
+			recommendOpts, err := recommendOptions(cmd.Context(), factory, opts)
+			if err != nil {
+				return err
+			}
+
+			plan, err := plugin.PlanFixes(cmd.Context(), client, opts.Owners, oomPods, plugin.FixOptions{
+				Factor:    fixFactor,
+				Recommend: recommendOpts,
+				PatchType: plugin.PatchType(patchType),
+			})
+			if err != nil {
+				return err
+			}
+
+			if len(plan.Patches) == 0 && len(plan.Skipped) == 0 {
+				if allNamespaces {
+					fmt.Fprintln(out, "No out of memory pods found.")
+					return nil
+				}
+				fmt.Fprintf(out, "No out of memory pods found in %s namespace.\n", opts.Namespace)
+				return nil
+			}
+
+			printFixPlan(out, plan)
+
+			if len(plan.Patches) == 0 {
+				return nil
+			}
+
+			if fixDryRun == dryRunServer {
+				return applyFixPlan(cmd.Context(), out, client, plan, true)
+			}
+
+			if !applyFixes {
+				return nil
+			}
+
+			confirmed, err := confirm(cmd.InOrStdin(), out, fmt.Sprintf("Apply %d patch(es) to the cluster?", len(plan.Patches)))
+			if err != nil {
+				return err
+			}
+			if !confirmed {
+				fmt.Fprintln(out, "Aborted, nothing was changed.")
+				return nil
+			}
+
+			return applyFixPlan(cmd.Context(), out, client, plan, false)
+		},
+	}
+
+	cmd.Flags().Float64Var(&fixFactor, "factor", 0, "Multiply the current memory limit by this factor, such as 1.5, rather than using the recommended limit")
+	cmd.Flags().IntVar(&headroom, "headroom", int(plugin.DefaultHeadroom*100), "Percentage of memory added to the recommended limit for each recent OOM, up to 3")
+	cmd.Flags().DurationVar(&recentWindow, "recent-window", plugin.DefaultRecentWindow, "How recently a container must have been OOMKilled for its headroom to be added to the recommended limit")
+	cmd.Flags().StringVar(&patchType, "patch-type", string(plugin.PatchTypeStrategic), "The type of patch to generate. One of: (strategic, json)")
+	cmd.Flags().StringVar(&fixDryRun, "dry-run", dryRunClient, "Either 'client' to only print the patches, or 'server' to also validate them with the API server without changing anything")
+	cmd.Flags().BoolVar(&applyFixes, "apply", false, "Apply the patches to the cluster, after confirmation")
+	cmd.Flags().StringVar(&prometheusURL, "prometheus-url", "", "Use the peak memory of each container before it was terminated from a Prometheus compatible API at this URL")
+	cmd.Flags().StringVar(&prometheusQuery, "prometheus-query", plugin.DefaultPrometheusQuery, "Go template of the query for the memory of a container, given the fields of a termination such as .Namespace, .Pod and .Container")
+
+	return cmd
+}
+
+// printFixPlan writes each patch as a `kubectl patch` command, with a comment
+// describing the change, so that the output can be reviewed or run as a script.
+func printFixPlan(w io.Writer, plan plugin.FixPlan) {
+
+	for _, p := range plan.Patches {
+
+		changes := make([]string, 0, len(p.Changes))
+		for _, c := range p.Changes {
+			from := c.From.String()
+			if c.From.IsZero() {
+				from = "<none>"
+			}
+			changes = append(changes, fmt.Sprintf("%s from %s to %s", c.Container, from, c.To.String()))
+		}
+
+		fmt.Fprintf(w, "# %s/%s in %s: raise the memory limit of %s\n", p.Kind, p.Name, p.Namespace, strings.Join(changes, ", "))
+		fmt.Fprintf(w, "kubectl patch %s %s -n %s --type %s -p '%s'\n", strings.ToLower(p.Kind), p.Name, p.Namespace, p.Type, p.Data)
+	}
+
+	for _, s := range plan.Skipped {
+		fmt.Fprintf(w, "# Skipped %s in %s: %s\n", s.Workload, s.Namespace, s.Reason)
+	}
+}
+
+// applyFixPlan sends every patch to the cluster, stopping at the first failure.
+// With dryRun, the patches are only validated by the API server.
+func applyFixPlan(ctx context.Context, out io.Writer, client kubernetes.Interface, plan plugin.FixPlan, dryRun bool) error {
+
+	suffix := ""
+	if dryRun {
+		suffix = " (server dry run)"
+	}
+
+	for _, p := range plan.Patches {
+		if err := p.Apply(ctx, client, dryRun); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "%s/%s patched%s\n", strings.ToLower(p.Kind), p.Name, suffix)
+	}
+
+	return nil
+}
+
+// confirm asks the question and returns whether it was answered with yes.
+func confirm(in io.Reader, out io.Writer, question string) (bool, error) {
+
+	fmt.Fprintf(out, "%s [y/N]: ", question)
+
+	answer, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return false, err
+	}
+
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true, nil
+	}
+
+	return false, nil
+}
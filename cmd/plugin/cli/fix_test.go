@@ -0,0 +1,124 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/jdockerty/kubectl-oomd/internal/testutil"
+	"github.com/jdockerty/kubectl-oomd/pkg/plugin"
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// fixObjects returns the checkout Deployment with an OOMKilled pod, along with
+// an OOMKilled pod which does not have a controller.
+func fixObjects() []runtime.Object {
+
+	controller := true
+	pod := testutil.Pod("shop", "checkout-5bcbcdf97-x2k8p", 137, "OOMKilled")
+	pod.Labels = map[string]string{appsv1.DefaultDeploymentUniqueLabelKey: "5bcbcdf97"}
+	pod.OwnerReferences = []metav1.OwnerReference{{APIVersion: "apps/v1", Kind: "ReplicaSet", Name: "checkout-5bcbcdf97", Controller: &controller}}
+
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "checkout"},
+		Spec:       appsv1.DeploymentSpec{Template: v1.PodTemplateSpec{Spec: pod.Spec}},
+	}
+
+	return []runtime.Object{deployment, pod, testutil.Pod("shop", "debug", 137, "OOMKilled")}
+}
+
+func TestFix(t *testing.T) {
+
+	tests := map[string]struct {
+		args []string
+		want string
+	}{
+		"recommended": {
+			args: []string{"fix", "-n", "shop"},
+			want: "# Deployment/checkout in shop: raise the memory limit of app from 128Mi to 160Mi\n" +
+				`kubectl patch deployment checkout -n shop --type strategic -p '{"spec":{"template":{"spec":{"containers":[{"name":"app","resources":{"limits":{"memory":"160Mi"}}}]}}}}'` + "\n" +
+				"# Skipped Pod/debug in shop: not owned by a Deployment, StatefulSet, DaemonSet or CronJob\n",
+		},
+		"factor with a json patch": {
+			args: []string{"fix", "-n", "shop", "--factor", "1.5", "--patch-type", "json"},
+			want: "# Deployment/checkout in shop: raise the memory limit of app from 128Mi to 192Mi\n" +
+				`kubectl patch deployment checkout -n shop --type json -p '[{"op":"test","path":"/spec/template/spec/containers/0/name","value":"app"},{"op":"add","path":"/spec/template/spec/containers/0/resources/limits/memory","value":"192Mi"}]'` + "\n" +
+				"# Skipped Pod/debug in shop: not owned by a Deployment, StatefulSet, DaemonSet or CronJob\n",
+		},
+		"server dry run": {
+			args: []string{"fix", "-n", "shop", "--dry-run", "server"},
+			want: "# Deployment/checkout in shop: raise the memory limit of app from 128Mi to 160Mi\n" +
+				`kubectl patch deployment checkout -n shop --type strategic -p '{"spec":{"template":{"spec":{"containers":[{"name":"app","resources":{"limits":{"memory":"160Mi"}}}]}}}}'` + "\n" +
+				"# Skipped Pod/debug in shop: not owned by a Deployment, StatefulSet, DaemonSet or CronJob\n" +
+				"deployment/checkout patched (server dry run)\n",
+		},
+		"no pods in namespace": {
+			args: []string{"fix", "-n", "empty"},
+			want: "No out of memory pods found in empty namespace.\n",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			out, err := runRootCmd(t, fixObjects(), tc.args...)
+			assert.Nil(t, err)
+			assert.Equal(t, tc.want, out)
+		})
+	}
+
+	for _, args := range [][]string{
+		{"fix", "-n", "shop", "--factor", "0.5"},
+		{"fix", "-n", "shop", "--patch-type", "merge"},
+		{"fix", "-n", "shop", "--dry-run", "none"},
+		{"fix", "-n", "shop", "--apply", "--dry-run", "server"},
+	} {
+		_, err := runRootCmd(t, fixObjects(), args...)
+		assert.NotNil(t, err, args)
+	}
+}
+
+func TestFixApply(t *testing.T) {
+
+	tests := map[string]struct {
+		answer    string
+		wantLimit string
+		wantOut   string
+	}{
+		"confirmed": {answer: "y\n", wantLimit: "160Mi", wantOut: "Apply 1 patch(es) to the cluster? [y/N]: deployment/checkout patched\n"},
+		"declined":  {answer: "\n", wantLimit: "128Mi", wantOut: "Apply 1 patch(es) to the cluster? [y/N]: Aborted, nothing was changed.\n"},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+
+			client := fake.NewSimpleClientset(fixObjects()...)
+
+			newClientFactory = func(configFlags *genericclioptions.ConfigFlags) plugin.ClientFactory {
+				return testutil.ClientFactory{RESTClientGetter: configFlags, Client: client}
+			}
+			defer func() { newClientFactory = plugin.NewClientFactory }()
+
+			var out bytes.Buffer
+			cmd := RootCmd()
+			cmd.SetOut(&out)
+			cmd.SetIn(strings.NewReader(tc.answer))
+			cmd.SetArgs([]string{"fix", "-n", "shop", "--apply"})
+
+			assert.Nil(t, cmd.Execute())
+			assert.True(t, strings.HasSuffix(out.String(), tc.wantOut), out.String())
+
+			deployment, err := client.AppsV1().Deployments("shop").Get(context.Background(), "checkout", metav1.GetOptions{})
+			assert.Nil(t, err)
+
+			limit := deployment.Spec.Template.Spec.Containers[0].Resources.Limits[v1.ResourceMemory]
+			assert.Equal(t, tc.wantLimit, limit.String())
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/jdockerty/kubectl-oomd/pkg/plugin"
+	"k8s.io/cli-runtime/pkg/printers"
+)
+
+// runGroupByOwner collapses the terminated pods into a row for each container of
+// their top-level workload, and prints them with the printer or as a table. The
+// rows are sorted by the fields of their most recent termination.
+func runGroupByOwner(ctx context.Context, out io.Writer, owners *plugin.OwnerResolver, printer printers.ResourcePrinter, pods plugin.TerminatedPods, fields []plugin.SortField, namespace string) error {
+
+	groups, err := plugin.GroupByOwner(ctx, owners, pods)
+	if err != nil {
+		return err
+	}
+
+	if len(fields) > 0 {
+		groups.SortBy(fields, reverseSort)
+	}
+
+	if printer != nil {
+		return printer.PrintObj(groups, out)
+	}
+
+	if len(groups.Items) == 0 {
+		if allNamespaces {
+			fmt.Fprintln(out, "No out of memory pods found.")
+			return nil
+		}
+		fmt.Fprintf(out, "No out of memory pods found in %s namespace.\n", namespace)
+		return nil
+	}
+
+	t := tabwriter.NewWriter(out, 10, 1, 5, ' ', 0)
+	if err := printGroupTable(t, groups.Items, allNamespaces, noHeaders); err != nil {
+		return err
+	}
+
+	return t.Flush()
+}
+
+// printGroupTable writes a row for each container of a workload, with the limit
+// and time of its most recent termination.
+func printGroupTable(w io.Writer, groups []plugin.WorkloadGroup, allNamespaces, noHeaders bool) error {
+
+	headers := []string{"WORKLOAD", "CONTAINER", "OOMS", "REPLICAS", "LIMIT", "LAST TERMINATION TIME"}
+	if allNamespaces {
+		headers = append([]string{"NAMESPACE"}, headers...)
+	}
+
+	if !noHeaders {
+		if _, err := fmt.Fprintln(w, strings.Join(headers, "\t")); err != nil {
+			return err
+		}
+	}
+
+	for _, g := range groups {
+		// An unset limit is shown in the same way as the ungrouped table.
+		limit := "0"
+		if g.Last.Memory.Limit != nil {
+			limit = g.Last.Memory.Limit.Quantity
+		}
+
+		values := []string{g.Workload, g.Container, strconv.Itoa(g.OOMs), strconv.Itoa(g.Replicas), limit, g.Last.TerminatedTime.String()}
+		if allNamespaces {
+			values = append([]string{g.Namespace}, values...)
+		}
+
+		if _, err := fmt.Fprintln(w, strings.Join(values, "\t")); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
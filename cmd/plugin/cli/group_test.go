@@ -0,0 +1,70 @@
+package cli
+
+import (
+	"testing"
+
+	"github.com/jdockerty/kubectl-oomd/internal/testutil"
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestRootCmdGroupByOwner(t *testing.T) {
+
+	controller := true
+	owned := func(kind, name string) []metav1.OwnerReference {
+		return []metav1.OwnerReference{{APIVersion: "apps/v1", Kind: kind, Name: name, Controller: &controller}}
+	}
+
+	objects := []runtime.Object{
+		&appsv1.ReplicaSet{ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "checkout-5bcbcdf97", OwnerReferences: owned("Deployment", "checkout")}},
+		testutil.Pod("shop", "debug", 137, "OOMKilled"),
+		testutil.Pod("other", "payments-1", 137, "OOMKilled"),
+	}
+	for _, name := range []string{"checkout-5bcbcdf97-a", "checkout-5bcbcdf97-b", "checkout-5bcbcdf97-c"} {
+		pod := testutil.Pod("shop", name, 137, "OOMKilled")
+		pod.OwnerReferences = owned("ReplicaSet", "checkout-5bcbcdf97")
+		objects = append(objects, pod)
+	}
+
+	tests := map[string]struct {
+		args []string
+		want string
+	}{
+		"namespace": {
+			args: []string{"-n", "shop", "--group-by", "owner"},
+			want: "WORKLOAD                CONTAINER     OOMS      REPLICAS     LIMIT     LAST TERMINATION TIME\n" +
+				"Deployment/checkout     app           3         3            128Mi     0001-01-01 00:00:00 +0000 UTC\n" +
+				"Pod/debug               app           1         1            128Mi     0001-01-01 00:00:00 +0000 UTC\n",
+		},
+		"all namespaces": {
+			args: []string{"-A", "--group-by", "owner", "--no-headers"},
+			want: "other     Pod/payments-1          app       1         1         128Mi     0001-01-01 00:00:00 +0000 UTC\n" +
+				"shop      Deployment/checkout     app       3         3         128Mi     0001-01-01 00:00:00 +0000 UTC\n" +
+				"shop      Pod/debug               app       1         1         128Mi     0001-01-01 00:00:00 +0000 UTC\n",
+		},
+		"structured": {
+			args: []string{"-n", "shop", "--group-by", "owner", "-o", "jsonpath={range .items[*]}{.workload} {.ooms} {.replicas}{\"\\n\"}{end}"},
+			want: "Deployment/checkout 3 3\nPod/debug 1 1\n",
+		},
+		"no pods": {
+			args: []string{"-n", "empty", "--group-by", "owner"},
+			want: "No out of memory pods found in empty namespace.\n",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			out, err := runRootCmd(t, objects, tc.args...)
+			assert.Nil(t, err)
+			assert.Equal(t, tc.want, out)
+		})
+	}
+
+	_, err := runRootCmd(t, objects, "-n", "shop", "--group-by", "node")
+	assert.NotNil(t, err)
+
+	_, err = runRootCmd(t, objects, "-n", "shop", "--group-by", "owner", "--watch")
+	assert.NotNil(t, err)
+}
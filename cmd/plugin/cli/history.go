@@ -0,0 +1,176 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/jdockerty/kubectl-oomd/pkg/plugin"
+	"github.com/spf13/cobra"
+)
+
+var (
+
+	// Provides the `--history` flag, the store which terminations are recorded in,
+	// such as `file:~/.kube/oomd/history.jsonl` or `configmap:monitoring/oomd-history`.
+	historySpec string
+
+	// Provides the `--workload` flag for querying the history, the time window is
+	// shared with the other commands.
+	historyWorkload string
+)
+
+func historyCmd() *cobra.Command {
+
+	printFlags := newPrintFlags()
+
+	cmd := &cobra.Command{
+		Use:   "history --history STORE",
+		Short: "Show OOMKilled containers recorded in the history",
+		Long: `Show the containers which were terminated by Kubernetes due to an 'Out Of Memory' error and recorded
+in the history, including those from pods which no longer exist.
+
+Terminations are recorded by any command which is given '--history', such as a regular run, '--watch',
+'serve' or 'notify'. The history is queried from the same store.`,
+		Args:          cobra.NoArgs,
+		SilenceErrors: true,
+		SilenceUsage:  true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+
+			out := cmd.OutOrStdout()
+
+			if historySpec == "" {
+				return fmt.Errorf("--history is required, such as file:~/.kube/oomd/history.jsonl or configmap:NAMESPACE/NAME")
+			}
+
+			printer, err := printFlags.toPrinter(noHeaders)
+			if err != nil {
+				return err
+			}
+
+			factory := newClientFactory(KubernetesConfigFlags)
+
+			store, err := openHistory(factory)
+			if err != nil {
+				return err
+			}
+
+			namespace, err := plugin.GetNamespace(factory, allNamespaces, *KubernetesConfigFlags.Namespace)
+			if err != nil {
+				return fmt.Errorf("unable to retrieve namespace, got %s: %w", *KubernetesConfigFlags.Namespace, err)
+			}
+
+			from, to, err := timeWindow()
+			if err != nil {
+				return err
+			}
+
+			query := plugin.HistoryQuery{Namespace: namespace, Owner: historyWorkload, Since: from, Until: to}
+
+			terminations, err := store.Query(cmd.Context(), query)
+			if err != nil {
+				return err
+			}
+
+			if printer != nil {
+				return printer.PrintObj(plugin.NewTerminationList(terminations), out)
+			}
+
+			if len(terminations) == 0 {
+				if allNamespaces {
+					fmt.Fprintln(out, "No out of memory pods found in the history.")
+					return nil
+				}
+				fmt.Fprintf(out, "No out of memory pods found in the history for %s namespace.\n", namespace)
+				return nil
+			}
+
+			t := tabwriter.NewWriter(out, 10, 1, 5, ' ', 0)
+			if err := printHistoryTable(t, terminations, allNamespaces, noHeaders); err != nil {
+				return err
+			}
+
+			return t.Flush()
+		},
+	}
+
+	printFlags.addFlags(cmd)
+	cmd.Flags().BoolVar(&noHeaders, "no-headers", false, "Don't print headers")
+	cmd.Flags().StringVar(&historyWorkload, "workload", "", "Only show terminations from pods belonging to a workload, such as Deployment/checkout")
+
+	return cmd
+}
+
+// printHistoryTable writes the recorded terminations as a table, the pods may no
+// longer exist so these have the owner rather than the container type and state.
+func printHistoryTable(w io.Writer, terminations []plugin.Termination, allNamespaces, noHeaders bool) error {
+
+	headers := []string{"POD", "CONTAINER", "OWNER", "CATEGORY", "REQUEST", "LIMIT", "TERMINATION TIME"}
+	if allNamespaces {
+		headers = append([]string{"NAMESPACE"}, headers...)
+	}
+
+	if !noHeaders {
+		if _, err := fmt.Fprintln(w, strings.Join(headers, "\t")); err != nil {
+			return err
+		}
+	}
+
+	quantity := func(q *plugin.MemoryQuantity) string {
+		if q == nil {
+			return "0"
+		}
+		return q.Quantity
+	}
+
+	for _, t := range terminations {
+		values := []string{t.Pod, t.Container, valueOrNone(t.Owner), string(t.Category), quantity(t.Memory.Request), quantity(t.Memory.Limit), t.TerminatedTime.String()}
+		if allNamespaces {
+			values = append([]string{t.Namespace}, values...)
+		}
+
+		if _, err := fmt.Fprintln(w, strings.Join(values, "\t")); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// openHistory opens the store given to `--history`, this is nil when it is not given.
+// ConfigMaps without a namespace are stored in the kubeconfig's current namespace.
+func openHistory(factory plugin.ClientFactory) (plugin.HistoryStore, error) {
+
+	if historySpec == "" {
+		return nil, nil
+	}
+
+	namespace, _, err := factory.ToRawKubeConfigLoader().Namespace()
+	if err != nil {
+		return nil, err
+	}
+
+	return plugin.OpenHistoryStore(historySpec, factory.KubernetesClient, namespace)
+}
+
+// recordHistory records each termination in the store, before passing it on to the
+// handler. The history is secondary to the command being run, so failures are
+// written to errOut rather than stopping it.
+func recordHistory(ctx context.Context, store plugin.HistoryStore, errOut io.Writer, handler plugin.TerminationHandler) plugin.TerminationHandler {
+
+	if store == nil {
+		return handler
+	}
+
+	return plugin.TerminationHandlerFuncs{
+		TerminationFunc: func(t plugin.TerminatedPodInfo) error {
+			if err := store.Record(ctx, []plugin.Termination{t.ToTermination()}); err != nil {
+				fmt.Fprintf(errOut, "unable to record history: %s\n", err)
+			}
+			return handler.OnTermination(t)
+		},
+		DeleteFunc: handler.OnDelete,
+	}
+}
@@ -0,0 +1,77 @@
+package cli
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"testing"
+
+	"github.com/jdockerty/kubectl-oomd/internal/testutil"
+	"github.com/jdockerty/kubectl-oomd/pkg/plugin"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestHistory(t *testing.T) {
+
+	history := "file:" + filepath.Join(t.TempDir(), "history.jsonl")
+
+	controller := true
+	checkout := testutil.Pod("shop", "checkout-1", 137, "OOMKilled")
+	checkout.OwnerReferences = []metav1.OwnerReference{{Kind: "StatefulSet", Name: "checkout", Controller: &controller}}
+
+	// Terminations are recorded by a regular run, including those from other runs
+	// whose pods have since been deleted.
+	_, err := runRootCmd(t, []runtime.Object{checkout, testutil.Pod("other", "payments-1", 137, "OOMKilled")}, "-A", "--history", history)
+	assert.Nil(t, err)
+
+	_, err = runRootCmd(t, []runtime.Object{testutil.Pod("shop", "checkout-2", 137, "OOMKilled")}, "-n", "shop", "--history", history)
+	assert.Nil(t, err)
+
+	tests := map[string]struct {
+		args []string
+		want string
+	}{
+		"namespace": {
+			args: []string{"history", "-n", "shop"},
+			want: "POD            CONTAINER     OWNER                    CATEGORY      REQUEST     LIMIT     TERMINATION TIME\n" +
+				"checkout-1     app           StatefulSet/checkout     OOMKilled     0           128Mi     0001-01-01 00:00:00 +0000 UTC\n" +
+				"checkout-2     app           <none>                   OOMKilled     0           128Mi     0001-01-01 00:00:00 +0000 UTC\n",
+		},
+		"workload across all namespaces": {
+			args: []string{"history", "-A", "--workload", "statefulset/checkout", "--no-headers"},
+			want: "shop      checkout-1     app       StatefulSet/checkout     OOMKilled     0         128Mi     0001-01-01 00:00:00 +0000 UTC\n",
+		},
+		"nothing recorded": {
+			args: []string{"history", "-n", "empty"},
+			want: "No out of memory pods found in the history for empty namespace.\n",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			out, err := runRootCmd(t, nil, append(tc.args, "--history", history)...)
+			assert.Nil(t, err)
+			assert.Equal(t, tc.want, out)
+		})
+	}
+
+	out, err := runRootCmd(t, nil, "history", "-A", "-o", "json", "--history", history)
+	assert.Nil(t, err)
+
+	var list plugin.TerminationList
+	assert.Nil(t, json.Unmarshal([]byte(out), &list))
+	assert.Equal(t, 3, len(list.Items))
+}
+
+func TestHistoryInvalid(t *testing.T) {
+
+	_, err := runRootCmd(t, nil, "history", "-n", "shop")
+	assert.NotNil(t, err, "a history store is required")
+
+	_, err = runRootCmd(t, nil, "history", "-n", "shop", "--history", "file:/tmp/history.jsonl", "--until", "yesterday")
+	assert.NotNil(t, err)
+
+	_, err = runRootCmd(t, nil, "-n", "shop", "--history", "sqlite:history.db")
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,132 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jdockerty/kubectl-oomd/pkg/plugin"
+	"github.com/spf13/cobra"
+)
+
+var (
+
+	// Provides the `--webhook` flag, which may be given multiple times to notify
+	// more than one endpoint.
+	webhooks []string
+
+	// Provides the `--webhook-format` and `--template-file` flags, controlling the
+	// payload which is sent.
+	webhookFormat string
+	templateFile  string
+
+	// Provides the `--rate-limit`, `--retries`, `--retry-backoff` and `--webhook-timeout` flags.
+	rateLimit      time.Duration
+	retries        int
+	retryBackoff   time.Duration
+	webhookTimeout time.Duration
+)
+
+func notifyCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "notify --webhook URL [--webhook URL ...]",
+		Short: "Send new OOMKilled containers to webhooks",
+		Long: `Watch for containers which are terminated by Kubernetes due to an 'Out Of Memory' error and POST
+each one to the given webhooks as it happens. Terminations which happened before starting are not sent, unless
+'--since' or '--since-time' is given, in which case those within the window are sent as well.
+
+The payload is either generic JSON, a Slack compatible message or a CloudEvent. A custom payload can be
+given with '--template-file', which is a Go template that is given the same fields as the JSON payload.`,
+		Args:          cobra.NoArgs,
+		SilenceErrors: true,
+		SilenceUsage:  true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+
+			if len(webhooks) == 0 {
+				return fmt.Errorf("at least one --webhook is required")
+			}
+
+			if webhookTimeout <= 0 {
+				return fmt.Errorf("invalid --webhook-timeout %s, must be greater than 0", webhookTimeout)
+			}
+
+			if err := checkWatchWindow("notify"); err != nil {
+				return err
+			}
+
+			var payloadTemplate string
+			if templateFile != "" {
+				b, err := os.ReadFile(templateFile)
+				if err != nil {
+					return fmt.Errorf("unable to read template file: %w", err)
+				}
+				payloadTemplate = string(b)
+			}
+
+			factory := newClientFactory(KubernetesConfigFlags)
+
+			opts, err := buildOptions(factory, nil)
+			if err != nil {
+				return err
+			}
+
+			// Only new terminations are sent, unless the window starts earlier.
+			since := opts.Since
+			if since.IsZero() {
+				since = time.Now()
+			}
+
+			notifier, err := plugin.NewNotifier(plugin.NotifierOptions{
+				URLs:      webhooks,
+				Format:    plugin.WebhookFormat(webhookFormat),
+				Template:  payloadTemplate,
+				RateLimit: rateLimit,
+				Retries:   retries,
+				Backoff:   retryBackoff,
+				Timeout:   webhookTimeout,
+				Since:     since,
+			})
+			if err != nil {
+				return err
+			}
+
+			// The owner of each termination is included in the payload.
+			if opts.Owners, err = plugin.NewOwnerResolver(factory); err != nil {
+				return err
+			}
+
+			client, err := factory.KubernetesClient()
+			if err != nil {
+				return err
+			}
+
+			store, err := openHistory(factory)
+			if err != nil {
+				return err
+			}
+
+			// A webhook being unavailable should not stop notifications to the others,
+			// or those which happen once it is available again.
+			errOut := cmd.ErrOrStderr()
+			handler := notifier.Handler(cmd.Context(), func(err error) {
+				fmt.Fprintln(errOut, err)
+			})
+			opts.OnWatchError = func(err error) {
+				fmt.Fprintln(errOut, err)
+			}
+
+			return plugin.WatchWithHandler(cmd.Context(), client, opts, recordHistory(cmd.Context(), store, errOut, handler))
+		},
+	}
+
+	cmd.Flags().StringArrayVar(&webhooks, "webhook", nil, "URL to POST each new OOMKilled container to, may be given multiple times")
+	cmd.Flags().StringVar(&webhookFormat, "webhook-format", string(plugin.WebhookFormatJSON), fmt.Sprintf("Payload format sent to the webhooks. One of: (%s)", strings.Join(plugin.WebhookFormats(), ", ")))
+	cmd.Flags().StringVar(&templateFile, "template-file", "", "Path to a Go template for the payload, overriding the format's payload but keeping its content type")
+	cmd.Flags().DurationVar(&rateLimit, "rate-limit", 5*time.Minute, "Minimum time between notifications for the same workload, those in between are counted in the next one. Pass 0 to disable.")
+	cmd.Flags().IntVar(&retries, "retries", 3, "Number of times a failed notification is retried")
+	cmd.Flags().DurationVar(&retryBackoff, "retry-backoff", time.Second, "Time to wait before the first retry, this doubles with each retry")
+	cmd.Flags().DurationVar(&webhookTimeout, "webhook-timeout", plugin.DefaultWebhookTimeout, "Timeout of each request to a webhook")
+
+	return cmd
+}
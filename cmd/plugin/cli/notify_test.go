@@ -0,0 +1,111 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jdockerty/kubectl-oomd/internal/testutil"
+	"github.com/jdockerty/kubectl-oomd/pkg/plugin"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestNotify(t *testing.T) {
+
+	bodies := make(chan []byte, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		bodies <- b
+	}))
+	defer server.Close()
+
+	// The existing termination happened before the notifier started, so is not sent.
+	client, watching := testutil.WatchedClient(testutil.Pod("shop", "checkout-1", 137, "OOMKilled"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	done := make(chan error)
+	go func() {
+		done <- runRootCmdContext(ctx, &bytes.Buffer{}, client, "notify", "-n", "shop", "--webhook", server.URL)
+	}()
+
+	<-watching
+
+	killed := testutil.Pod("shop", "checkout-2", 137, "OOMKilled")
+	killed.Status.ContainerStatuses[0].LastTerminationState.Terminated.FinishedAt = metav1.NewTime(time.Now().Add(time.Minute))
+	_, err := client.CoreV1().Pods("shop").Create(ctx, killed, metav1.CreateOptions{})
+	assert.Nil(t, err)
+
+	select {
+	case b := <-bodies:
+		var n plugin.Notification
+		assert.Nil(t, json.Unmarshal(b, &n))
+		assert.Equal(t, "checkout-2", n.Pod)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for a notification")
+	}
+
+	cancel()
+	assert.Nil(t, <-done)
+	assert.Equal(t, 0, len(bodies))
+}
+
+func TestNotifySince(t *testing.T) {
+
+	bodies := make(chan []byte, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		bodies <- b
+	}))
+	defer server.Close()
+
+	// The existing terminations within the window are sent, as well as new ones.
+	recent := testutil.Pod("shop", "checkout-1", 137, "OOMKilled")
+	recent.Status.ContainerStatuses[0].LastTerminationState.Terminated.FinishedAt = metav1.NewTime(time.Now().Add(-time.Minute))
+	client, watching := testutil.WatchedClient(recent, testutil.Pod("shop", "checkout-2", 137, "OOMKilled"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	done := make(chan error)
+	go func() {
+		done <- runRootCmdContext(ctx, &bytes.Buffer{}, client, "notify", "-n", "shop", "--webhook", server.URL, "--since", "1h")
+	}()
+
+	<-watching
+
+	select {
+	case b := <-bodies:
+		var n plugin.Notification
+		assert.Nil(t, json.Unmarshal(b, &n))
+		assert.Equal(t, "checkout-1", n.Pod)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for a notification")
+	}
+
+	cancel()
+	assert.Nil(t, <-done)
+	assert.Equal(t, 0, len(bodies))
+}
+
+func TestNotifyInvalid(t *testing.T) {
+
+	_, err := runRootCmd(t, nil, "notify", "-n", "shop")
+	assert.NotNil(t, err, "a webhook is required")
+
+	_, err = runRootCmd(t, nil, "notify", "-n", "shop", "--webhook", "http://localhost", "--webhook-format", "xml")
+	assert.NotNil(t, err)
+
+	_, err = runRootCmd(t, nil, "notify", "-n", "shop", "--webhook", "http://localhost", "--webhook-timeout", "0s")
+	assert.NotNil(t, err)
+
+	_, err = runRootCmd(t, nil, "notify", "-n", "shop", "--webhook", "http://localhost", "--until", "2023-01-02T15:04:05Z")
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,83 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/cli-runtime/pkg/printers"
+	"k8s.io/kubectl/pkg/cmd/get"
+)
+
+// printFlags composes the kubectl printers which are supported by the plugin, these
+// print the versioned TerminationList. The default table output is not included,
+// as it is specific to the plugin.
+type printFlags struct {
+	jsonYamlFlags      *genericclioptions.JSONYamlPrintFlags
+	templateFlags      *genericclioptions.KubeTemplatePrintFlags
+	customColumnsFlags *get.CustomColumnsPrintFlags
+
+	outputFormat string
+}
+
+func newPrintFlags() *printFlags {
+	return &printFlags{
+		jsonYamlFlags:      genericclioptions.NewJSONYamlPrintFlags(),
+		templateFlags:      genericclioptions.NewKubeTemplatePrintFlags(),
+		customColumnsFlags: get.NewCustomColumnsPrintFlags(),
+	}
+}
+
+// allowedFormats returns every output format which is supported, in addition
+// to the default table.
+func (f *printFlags) allowedFormats() []string {
+	formats := []string{outputFormatWide}
+	formats = append(formats, f.jsonYamlFlags.AllowedFormats()...)
+	formats = append(formats, f.templateFlags.AllowedFormats()...)
+	formats = append(formats, f.customColumnsFlags.AllowedFormats()...)
+	return formats
+}
+
+// addFlags binds the `--output` flag along with those used by the template
+// printers, such as `--template`, to the command.
+func (f *printFlags) addFlags(cmd *cobra.Command) {
+	f.templateFlags.AddFlags(cmd)
+	cmd.Flags().StringVarP(&f.outputFormat, "output", "o", f.outputFormat, fmt.Sprintf("Output format. One of: (%s).", strings.Join(f.allowedFormats(), ", ")))
+}
+
+// toPrinter returns the printer for the requested output format, this is nil
+// when the default or wide table output should be used.
+func (f *printFlags) toPrinter(noHeaders bool) (printers.ResourcePrinter, error) {
+
+	outputFormat := f.outputFormat
+
+	// Similar to `kubectl get`, a `--template` argument implies the go-template
+	// output format when no other format is given.
+	if f.templateFlags.TemplateArgument != nil && len(*f.templateFlags.TemplateArgument) > 0 && len(outputFormat) == 0 {
+		outputFormat = "go-template"
+	}
+
+	if outputFormat == outputFormatTable || outputFormat == outputFormatWide {
+		return nil, nil
+	}
+
+	if p, err := f.jsonYamlFlags.ToPrinter(outputFormat); !genericclioptions.IsNoCompatiblePrinterError(err) {
+		return p, err
+	}
+
+	if p, err := f.templateFlags.ToPrinter(outputFormat); !genericclioptions.IsNoCompatiblePrinterError(err) {
+		return p, err
+	}
+
+	f.customColumnsFlags.NoHeaders = noHeaders
+	if f.templateFlags.TemplateArgument != nil {
+		f.customColumnsFlags.TemplateArgument = *f.templateFlags.TemplateArgument
+	}
+
+	if p, err := f.customColumnsFlags.ToPrinter(outputFormat); !genericclioptions.IsNoCompatiblePrinterError(err) {
+		return p, err
+	}
+
+	return nil, fmt.Errorf("%s is not a supported output format. One of: (%s)", outputFormat, strings.Join(f.allowedFormats(), ", "))
+}
@@ -0,0 +1,91 @@
+package cli
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/jdockerty/kubectl-oomd/pkg/plugin"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestPrintFlags(t *testing.T) {
+
+	list := &plugin.TerminationList{
+		TypeMeta: metav1.TypeMeta{APIVersion: plugin.APIVersion, Kind: plugin.TerminationListKind},
+		Items: []plugin.Termination{
+			{
+				TypeMeta:  metav1.TypeMeta{APIVersion: plugin.APIVersion, Kind: plugin.TerminationKind},
+				Namespace: "oomkilled",
+				Pod:       "my-app-1",
+				Container: "infoapp",
+				Category:  plugin.CategoryOOMKilled,
+				Memory:    plugin.MemoryQuantities{Limit: &plugin.MemoryQuantity{Quantity: "8G", Bytes: 8000000000}},
+			},
+			{
+				TypeMeta:  metav1.TypeMeta{APIVersion: plugin.APIVersion, Kind: plugin.TerminationKind},
+				Namespace: "oomkilled",
+				Pod:       "my-app-2",
+				Container: "sidecar",
+				Category:  plugin.CategorySIGKILL,
+			},
+		},
+	}
+
+	tests := map[string]struct {
+		format    string
+		noHeaders bool
+		want      string
+	}{
+		"jsonpath": {
+			format: `jsonpath={range .items[*]}{.pod}/{.container}{"\n"}{end}`,
+			want:   "my-app-1/infoapp\nmy-app-2/sidecar\n",
+		},
+		"go-template": {
+			format: `go-template={{range .items}}{{.pod}} {{.category}}{{"\n"}}{{end}}`,
+			want:   "my-app-1 OOMKilled\nmy-app-2 SIGKILL\n",
+		},
+		"custom-columns": {
+			format: "custom-columns=POD:.pod,LIMIT:.memory.limit.bytes",
+			want:   "POD        LIMIT\nmy-app-1   8000000000\nmy-app-2   <none>\n",
+		},
+		"custom-columns without headers": {
+			format:    "custom-columns=POD:.pod",
+			noHeaders: true,
+			want:      "my-app-1\nmy-app-2\n",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+
+			flags := newPrintFlags()
+			flags.outputFormat = tc.format
+
+			printer, err := flags.toPrinter(tc.noHeaders)
+			assert.Nil(t, err)
+
+			var buf bytes.Buffer
+			assert.Nil(t, printer.PrintObj(list, &buf))
+			assert.Equal(t, tc.want, buf.String())
+		})
+	}
+}
+
+func TestPrintFlagsTable(t *testing.T) {
+
+	flags := newPrintFlags()
+
+	printer, err := flags.toPrinter(false)
+	assert.Nil(t, err)
+	assert.Nil(t, printer, "default output should be the table")
+}
+
+func TestPrintFlagsUnsupported(t *testing.T) {
+
+	flags := newPrintFlags()
+	flags.outputFormat = "wat"
+
+	_, err := flags.toPrinter(false)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,198 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jdockerty/kubectl-oomd/pkg/plugin"
+	"github.com/spf13/cobra"
+)
+
+// Provides the `--headroom` flag, the percentage of memory added for each recent OOM.
+var headroom int
+
+// Provides the `--recent-window` flag, how recently an OOM must have been for its headroom to be added.
+var recentWindow time.Duration
+
+func recommendCmd() *cobra.Command {
+
+	printFlags := newPrintFlags()
+
+	cmd := &cobra.Command{
+		Use:   "recommend [TYPE/NAME ...]",
+		Short: "Recommend a memory request and limit for OOMKilled containers",
+		Long: `Recommend a new memory request and limit for each container which was terminated by Kubernetes due
+to an 'Out Of Memory' error, along with the rationale behind it.
+
+The pods are combined by their top-level workload, such as the CronJob of each Job, so there is a single
+recommendation for each of its containers. The limit is raised above the limit it was killed at, or the memory
+it was seen to use if higher, by the '--headroom' for each OOM within the '--recent-window', up to 3. Kubernetes
+only keeps the last termination of a container, so its earlier OOMs are only counted from the '--history' when
+given, rather than from its restarts. The request is raised to cover the memory it was seen to use, but it is
+never lowered and the limit is never below it.
+
+The memory which was used is the current usage from metrics-server and, with '--prometheus-url', the peak
+before the container was killed.`,
+		Args:          cobra.ArbitraryArgs,
+		SilenceErrors: true,
+		SilenceUsage:  true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+
+			out := cmd.OutOrStdout()
+
+			if err := validateRecommendFlags(); err != nil {
+				return err
+			}
+
+			printer, err := printFlags.toPrinter(noHeaders)
+			if err != nil {
+				return err
+			}
+
+			factory := newClientFactory(KubernetesConfigFlags)
+
+			opts, err := buildOptions(factory, args)
+			if err != nil {
+				return err
+			}
+			opts.MemoryUsage = true
+
+			// The recommendations are made for the workload which owns each pod.
+			if opts.Owners, err = plugin.NewOwnerResolver(factory); err != nil {
+				return err
+			}
+
+			if prometheusURL != "" {
+				opts.Prometheus, err = plugin.NewPrometheus(plugin.PrometheusOptions{URL: prometheusURL, Query: prometheusQuery})
+				if err != nil {
+					return err
+				}
+			}
+
+			oomPods, err := plugin.Run(cmd.Context(), factory, opts)
+			if err != nil {
+				return err
+			}
+
+			recommendOpts, err := recommendOptions(cmd.Context(), factory, opts)
+			if err != nil {
+				return err
+			}
+
+			recommendations, err := plugin.Recommend(cmd.Context(), opts.Owners, oomPods, recommendOpts)
+			if err != nil {
+				return err
+			}
+
+			if printer != nil {
+				return printer.PrintObj(recommendations, out)
+			}
+
+			if len(recommendations.Items) == 0 {
+				if allNamespaces {
+					fmt.Fprintln(out, "No out of memory pods found.")
+					return nil
+				}
+				fmt.Fprintf(out, "No out of memory pods found in %s namespace.\n", opts.Namespace)
+				return nil
+			}
+
+			t := tabwriter.NewWriter(out, 10, 1, 5, ' ', 0)
+			if err := printRecommendationTable(t, recommendations.Items, allNamespaces, noHeaders); err != nil {
+				return err
+			}
+
+			return t.Flush()
+		},
+	}
+
+	printFlags.addFlags(cmd)
+	cmd.Flags().BoolVar(&noHeaders, "no-headers", false, "Don't print headers")
+	cmd.Flags().IntVar(&headroom, "headroom", int(plugin.DefaultHeadroom*100), "Percentage of memory added to the limit for each recent OOM, up to 3")
+	cmd.Flags().DurationVar(&recentWindow, "recent-window", plugin.DefaultRecentWindow, "How recently a container must have been OOMKilled for its headroom to be added")
+	cmd.Flags().StringVar(&prometheusURL, "prometheus-url", "", "Use the peak memory of each container before it was terminated from a Prometheus compatible API at this URL")
+	cmd.Flags().StringVar(&prometheusQuery, "prometheus-query", plugin.DefaultPrometheusQuery, "Go template of the query for the memory of a container, given the fields of a termination such as .Namespace, .Pod and .Container")
+
+	return cmd
+}
+
+// validateRecommendFlags checks the flags of the recommendation policy, which are
+// shared with the fix command.
+func validateRecommendFlags() error {
+
+	if headroom <= 0 {
+		return fmt.Errorf("invalid --headroom %d, must be a percentage greater than 0", headroom)
+	}
+
+	if recentWindow <= 0 {
+		return fmt.Errorf("invalid --recent-window %s, must be greater than 0", recentWindow)
+	}
+
+	return nil
+}
+
+// recommendOptions returns the recommendation policy from the flags, along with the
+// terminations recorded in the `--history` so that the earlier OOMs of a container
+// are counted.
+func recommendOptions(ctx context.Context, factory plugin.ClientFactory, opts plugin.Options) (plugin.RecommendOptions, error) {
+
+	recommend := plugin.RecommendOptions{Headroom: float64(headroom) / 100, RecentWindow: recentWindow}
+
+	store, err := openHistory(factory)
+	if err != nil || store == nil {
+		return recommend, err
+	}
+
+	recommend.History, err = store.Query(ctx, plugin.HistoryQuery{Namespace: opts.Namespace, Since: opts.Since, Until: opts.Until})
+	if err != nil {
+		return plugin.RecommendOptions{}, fmt.Errorf("unable to query history: %w", err)
+	}
+
+	return recommend, nil
+}
+
+// printRecommendationTable writes the recommendations as a table, alongside the
+// current request and limit so that the change is clear.
+func printRecommendationTable(w io.Writer, recommendations []plugin.Recommendation, allNamespaces, noHeaders bool) error {
+
+	headers := []string{"WORKLOAD", "CONTAINER", "OOMS", "REQUEST", "LIMIT", "NEW REQUEST", "NEW LIMIT", "RATIONALE"}
+	if allNamespaces {
+		headers = append([]string{"NAMESPACE"}, headers...)
+	}
+
+	if !noHeaders {
+		if _, err := fmt.Fprintln(w, strings.Join(headers, "\t")); err != nil {
+			return err
+		}
+	}
+
+	quantity := func(q *plugin.MemoryQuantity) string {
+		if q == nil {
+			return "<none>"
+		}
+		return q.Quantity
+	}
+
+	for _, r := range recommendations {
+		values := []string{
+			r.Workload, r.Container, strconv.Itoa(r.OOMs),
+			quantity(r.Current.Request), quantity(r.Current.Limit),
+			quantity(r.Recommended.Request), quantity(r.Recommended.Limit),
+			r.Rationale,
+		}
+		if allNamespaces {
+			values = append([]string{r.Namespace}, values...)
+		}
+
+		if _, err := fmt.Fprintln(w, strings.Join(values, "\t")); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,85 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jdockerty/kubectl-oomd/internal/testutil"
+	"github.com/jdockerty/kubectl-oomd/pkg/plugin"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestRecommend(t *testing.T) {
+
+	oomKilled := testutil.Pod("shop", "checkout-1", 137, "OOMKilled")
+	oomKilled.Status.ContainerStatuses[0].LastTerminationState.Terminated.FinishedAt = metav1.Now()
+
+	objects := []runtime.Object{oomKilled, testutil.Pod("shop", "checkout-2", 137, "Error")}
+
+	// An earlier OOM of the container, which is only known from the history.
+	history := filepath.Join(t.TempDir(), "history.jsonl")
+	earlier := plugin.Termination{
+		Namespace:      "shop",
+		Pod:            "checkout-1",
+		PodUID:         oomKilled.UID,
+		Container:      "app",
+		Category:       plugin.CategoryOOMKilled,
+		TerminatedTime: metav1.NewTime(time.Now().Add(-time.Hour)),
+	}
+	assert.Nil(t, (&plugin.FileHistory{Path: history}).Record(context.Background(), []plugin.Termination{earlier}))
+
+	tests := map[string]struct {
+		args []string
+		want string
+	}{
+		"namespace": {
+			args: []string{"recommend", "-n", "shop"},
+			want: "WORKLOAD           CONTAINER     OOMS      REQUEST     LIMIT     NEW REQUEST     NEW LIMIT     RATIONALE\n" +
+				"Pod/checkout-1     app           1         <none>      128Mi     <none>          160Mi         OOMKilled once at the 128Mi limit; limit raised to 160Mi with 25% headroom (25% per recent OOM, up to 3)\n",
+		},
+		"headroom": {
+			args: []string{"recommend", "-n", "shop", "--headroom", "50", "--no-headers"},
+			want: "Pod/checkout-1     app       1         <none>     128Mi     <none>     192Mi     OOMKilled once at the 128Mi limit; limit raised to 192Mi with 50% headroom (50% per recent OOM, up to 3)\n",
+		},
+		"outside the recent window": {
+			args: []string{"recommend", "-n", "shop", "--recent-window", "1ns", "--no-headers"},
+			want: "Pod/checkout-1     app       1         <none>     128Mi     <none>     160Mi     OOMKilled once (none in the last 0s) at the 128Mi limit; limit raised to 160Mi with 25% headroom (25% per recent OOM, up to 3)\n",
+		},
+		"earlier OOMs from the history": {
+			args: []string{"recommend", "-n", "shop", "--history", "file:" + history, "--no-headers"},
+			want: "Pod/checkout-1     app       2         <none>     128Mi     <none>     192Mi     OOMKilled 2 times at the 128Mi limit; limit raised to 192Mi with 50% headroom (25% per recent OOM, up to 3)\n",
+		},
+		"no pods in namespace": {
+			args: []string{"recommend", "-n", "empty"},
+			want: "No out of memory pods found in empty namespace.\n",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			out, err := runRootCmd(t, objects, tc.args...)
+			assert.Nil(t, err)
+			assert.Equal(t, tc.want, out)
+		})
+	}
+
+	out, err := runRootCmd(t, objects, "recommend", "-n", "shop", "-o", "json")
+	assert.Nil(t, err)
+
+	var list plugin.RecommendationList
+	assert.Nil(t, json.Unmarshal([]byte(out), &list))
+	assert.Equal(t, plugin.RecommendationListKind, list.Kind)
+	assert.Equal(t, 1, len(list.Items))
+	assert.Equal(t, int64(160*1024*1024), list.Items[0].Recommended.Limit.Bytes)
+
+	_, err = runRootCmd(t, objects, "recommend", "-n", "shop", "--headroom", "0")
+	assert.NotNil(t, err)
+
+	_, err = runRootCmd(t, objects, "recommend", "-n", "shop", "--recent-window", "0s")
+	assert.NotNil(t, err)
+}
@@ -1,11 +1,16 @@
 package cli
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"os"
+	"os/signal"
+	"strconv"
 	"strings"
+	"syscall"
 	"text/tabwriter"
+	"time"
 
 	"github.com/jdockerty/kubectl-oomd/pkg/plugin"
 	"github.com/jdockerty/kubectl-oomd/pkg/version"
@@ -31,11 +36,53 @@ var (
 	showVersion bool
 
 	// Provides the `--sort-field` flag, allowing sorting by field.
-	// Only 'time' is supported currently.
+	// Only 'time' is supported, this is kept alongside `--sort-by` for compatibility.
 	sortField string
 
-	// Formatting for table output, similar to other kubectl commands.
-	t = tabwriter.NewWriter(os.Stdout, 10, 1, 5, ' ', 0)
+	// Provides the `--sort-by` flag, a comma separated list of fields such as
+	// `limit,time`, and the `--reverse` flag to sort in descending order.
+	sortBy      string
+	reverseSort bool
+
+	// Provides the `--group-by` flag, collapsing the terminations of the replicas
+	// of a workload into a single row. Only 'owner' is supported currently.
+	groupBy string
+
+	// Provides the `--strict` flag, only reporting containers which were killed by
+	// the kernel/cgroup OOM killer, rather than any SIGKILL.
+	strict bool
+
+	// Provides the `--selector` or `-l`, `--field-selector` and `--node` flags,
+	// these are pushed down into the List call to restrict the pods retrieved.
+	labelSelector string
+	fieldSelector string
+	nodeName      string
+
+	// Provides the `--since`, `--since-time` and `--until` flags, only showing
+	// containers which were terminated within the time window.
+	since     time.Duration
+	sinceTime string
+	until     string
+
+	// Provides the `--watch` or `-w` flag, printing new terminations as they happen
+	// rather than a point-in-time snapshot.
+	watchTerminations bool
+
+	// Provides the `--prometheus-url` and `--prometheus-query` flags, querying the
+	// peak memory of each terminated container from a Prometheus compatible API.
+	prometheusURL   string
+	prometheusQuery string
+
+	// Provides the `--chunk-size` flag, the number of pods retrieved per page.
+	chunkSize int64
+
+	// Provides the `--output` or `-o` flag, printing the results in a structured
+	// format rather than the default table, such as `json` or `jsonpath=...`.
+	outputFlags *printFlags
+
+	// newClientFactory builds the clients used by the plugin from the kubeconfig
+	// flags, this is replaced in tests to use fake clients.
+	newClientFactory = plugin.NewClientFactory
 )
 
 const (
@@ -46,20 +93,28 @@ const (
 	// Sort by termination timestamp in ascending order.
 	sortFieldTerminationTime = "time"
 
-	// When using the namespace provided by the `--namespace/-n` flag or current context.
-	// This represents: Pod, Container, Request, Limit, and Termination Time
-	singleNamespaceFormatting = "%s\t%s\t%s\t%s\t%s\n"
+	// Do not group the terminations, each is shown on its own row.
+	groupByNone = "none"
 
-	// When using the `all-namespaces` flag, we must show which namespace the pod was in, this becomes an extra column.
-	// This represents: Namespace, Pod, Container, Request, Limit, and Termination Time
-	allNamespacesFormatting = "%s\t%s\t%s\t%s\t%s\t%s\n"
+	// Group the terminations by the top-level controller of their pods.
+	groupByOwner = "owner"
+
+	// The default output format, a table similar to other kubectl commands.
+	outputFormatTable = ""
+
+	// The table output with extra columns, such as the node and exit code.
+	outputFormatWide = "wide"
 )
 
 func RootCmd() *cobra.Command {
 	cmd := &cobra.Command{
-		Use:           "kubectl oomd",
-		Short:         "Show pods/containers which have recently been OOMKilled",
-		Long:          `Show pods and containers which have recently been terminated by Kubernetes due to an 'Out Of Memory' error`,
+		Use:   "kubectl oomd [TYPE/NAME ...]",
+		Short: "Show pods/containers which have recently been OOMKilled",
+		Long: `Show pods and containers which have recently been terminated by Kubernetes due to an 'Out Of Memory' error.
+
+Resources may be given as arguments, such as 'deploy/checkout' or 'statefulset/kafka pod/x', to only
+show the pods which belong to them.`,
+		Args:          cobra.ArbitraryArgs,
 		SilenceErrors: true,
 		SilenceUsage:  true,
 		PreRun: func(cmd *cobra.Command, args []string) {
@@ -67,103 +122,302 @@ func RootCmd() *cobra.Command {
 		},
 		RunE: func(cmd *cobra.Command, args []string) error {
 
+			out := cmd.OutOrStdout()
+
 			if showVersion {
 				versionInfo := version.GetVersion()
-				fmt.Printf("%s", versionInfo.ToString())
+				fmt.Fprintf(out, "%s", versionInfo.ToString())
 				return nil
 			}
 
-			// The namespace provided to the flag takes precedence.
-			ns := *KubernetesConfigFlags.Namespace
+			factory := newClientFactory(KubernetesConfigFlags)
 
-			namespace, err := plugin.GetNamespace(KubernetesConfigFlags, allNamespaces, ns)
+			printer, err := outputFlags.toPrinter(noHeaders)
 			if err != nil {
-				return fmt.Errorf("unable to retrieve namespace, got %s: %w", ns, err)
+				return err
 			}
 
-			oomPods, err := plugin.Run(KubernetesConfigFlags, namespace)
+			fields, err := sortFields()
 			if err != nil {
-				return errors.Unwrap(err)
+				return err
 			}
 
-			// Handle no pods/containers found in a similar fashion to `kubectl`
-			if len(oomPods) == 0 {
-				if allNamespaces {
-					fmt.Println("No out of memory pods found.")
-					return nil
-				}
-				fmt.Printf("No out of memory pods found in %s namespace.\n", namespace)
-				return nil
+			if groupBy != groupByNone && groupBy != groupByOwner {
+				return fmt.Errorf("%s is not a supported grouping. One of: (%s, %s)", groupBy, groupByNone, groupByOwner)
 			}
 
-			// Mutate our pods slice in-place depending on the sort-field flag
-			// that is used. The default is to do nothing to the slice; coincidentally
-			// this does sort by container name, or namespace if `--all-namespaces`
-			// flag is used.
-			switch sortField {
-			case sortFieldTerminationTime:
-				oomPods.SortByTimestamp()
-			case sortFieldDefault:
-			default:
-				return fmt.Errorf("%s is not a supported sortable field.", sortField)
-			}
-
-			// All namespaces flag requires the extra 'NAMESPACE' heading.
-			if allNamespaces {
-				if !noHeaders {
-					_, err := fmt.Fprintf(t, allNamespacesFormatting, "NAMESPACE", "POD", "CONTAINER", "REQUEST", "LIMIT", "TERMINATION TIME")
-					if err != nil {
-						return err
-					}
-				}
+			opts, err := buildOptions(factory, args)
+			if err != nil {
+				return err
+			}
 
-				for _, p := range oomPods {
-					_, err := fmt.Fprintf(t, allNamespacesFormatting, p.Pod.Namespace, p.Pod.Name, p.ContainerName, p.Memory.Request, p.Memory.Limit, p.TerminatedTime)
-					if err != nil {
-						return err
-					}
+			store, err := openHistory(factory)
+			if err != nil {
+				return err
+			}
 
+			// Resolving the owners lists the owners of the pods, so this is only done
+			// when they are used, as the tables do not show them.
+			if printer != nil || groupBy == groupByOwner || store != nil {
+				if opts.Owners, err = plugin.NewOwnerResolver(factory); err != nil {
+					return err
 				}
-
-				t.Flush()
-				return nil
 			}
 
-			if !noHeaders {
-				_, err := fmt.Fprintf(t, singleNamespaceFormatting, "POD", "CONTAINER", "REQUEST", "LIMIT", "TERMINATION TIME")
-				if err != nil {
+			if watchTerminations {
+				if prometheusURL != "" {
+					return fmt.Errorf("--prometheus-url is not supported with --watch, as the memory before a new termination may not have been scraped yet")
+				}
+				if groupBy != groupByNone {
+					return fmt.Errorf("--group-by is not supported with --watch, as each new termination is printed as it happens")
+				}
+				if err := checkWatchWindow("--watch"); err != nil {
 					return err
 				}
+				return runWatch(cmd.Context(), out, cmd.ErrOrStderr(), factory, store, opts)
 			}
 
-			for _, p := range oomPods {
-				_, err := fmt.Fprintf(t, singleNamespaceFormatting, p.Pod.Name, p.ContainerName, p.Memory.Request, p.Memory.Limit, p.TerminatedTime)
+			opts.MemoryUsage = true
+
+			if prometheusURL != "" {
+				opts.Prometheus, err = plugin.NewPrometheus(plugin.PrometheusOptions{URL: prometheusURL, Query: prometheusQuery})
 				if err != nil {
 					return err
 				}
 			}
 
-			t.Flush()
+			oomPods, err := plugin.Run(cmd.Context(), factory, opts)
+			if err != nil {
+				return errors.Unwrap(err)
+			}
+
+			// The history is secondary to the output, so this does not fail the command.
+			if store != nil {
+				if err := store.Record(cmd.Context(), oomPods.ToList().Items); err != nil {
+					fmt.Fprintf(cmd.ErrOrStderr(), "unable to record history: %s\n", err)
+				}
+			}
+
+			if groupBy == groupByOwner {
+				return runGroupByOwner(cmd.Context(), out, opts.Owners, printer, oomPods, fields, opts.Namespace)
+			}
+
+			// Mutate our pods slice in-place depending on the sort flags that are
+			// used. The default is to do nothing to the slice; coincidentally this
+			// does sort by container name, or namespace if `--all-namespaces` flag
+			// is used.
+			if len(fields) > 0 {
+				oomPods.SortBy(fields, reverseSort)
+			}
+
+			// Structured output is printed even when there are no pods, as an empty
+			// list is more useful than a message to scripts consuming the output.
+			if printer != nil {
+				return printer.PrintObj(oomPods.ToList(), out)
+			}
+
+			// Handle no pods/containers found in a similar fashion to `kubectl`
+			if len(oomPods) == 0 {
+				if allNamespaces {
+					fmt.Fprintln(out, "No out of memory pods found.")
+					return nil
+				}
+				fmt.Fprintf(out, "No out of memory pods found in %s namespace.\n", opts.Namespace)
+				return nil
+			}
+
+			// Formatting for table output, similar to other kubectl commands.
+			t := tabwriter.NewWriter(out, 10, 1, 5, ' ', 0)
 
-			return nil
+			columns := tableColumns(allNamespaces, outputFlags.outputFormat == outputFormatWide, opts.MemoryUsage, opts.Prometheus != nil)
+			if err := printTable(t, oomPods, columns, noHeaders); err != nil {
+				return err
+			}
+
+			return t.Flush()
 		},
 	}
 
+	cmd.AddCommand(serveCmd(), notifyCmd(), historyCmd(), recommendCmd(), fixCmd(), summaryCmd())
+
 	cobra.OnInitialize(initConfig)
 
-	cmd.Flags().StringVar(&sortField, "sort-field", "none", "Sort by particular field. (Only 'time' is supported currently)")
+	cmd.Flags().StringVar(&sortField, "sort-field", "none", "Sort by particular field. (Only 'time' is supported, use --sort-by for other fields)")
+	cmd.Flags().StringVar(&sortBy, "sort-by", "", "Comma separated fields to sort by, later fields break ties. One or more of: (namespace, pod, container, request, limit, node, restarts, time)")
+	cmd.Flags().BoolVar(&reverseSort, "reverse", false, "Sort in descending order, such as the highest limit first")
+	outputFlags = newPrintFlags()
+	outputFlags.addFlags(cmd)
+	cmd.Flags().StringVar(&groupBy, "group-by", groupByNone, "Group the rows. One of: (none, owner), where 'owner' collapses the replicas of each workload into a single row per container")
 	cmd.Flags().BoolVar(&noHeaders, "no-headers", false, "Don't print headers")
-	cmd.Flags().BoolVarP(&allNamespaces, "all-namespaces", "A", false, "Show OOMKilled containers across all namespaces")
+	cmd.PersistentFlags().BoolVarP(&allNamespaces, "all-namespaces", "A", false, "Show OOMKilled containers across all namespaces")
+	cmd.PersistentFlags().StringVarP(&labelSelector, "selector", "l", "", "Selector (label query) to filter pods on, supports '=', '==', and '!='.(e.g. -l key1=value1,key2=value2)")
+	cmd.PersistentFlags().StringVar(&fieldSelector, "field-selector", "", "Selector (field query) to filter pods on, supports '=', '==', and '!='.(e.g. --field-selector status.phase=Running)")
+	cmd.PersistentFlags().StringVar(&nodeName, "node", "", "Only show OOMKilled containers from pods scheduled onto this node")
+	cmd.PersistentFlags().DurationVar(&since, "since", 0, "Only show containers terminated within a relative duration, such as 2h. Defaults to all terminations.")
+	cmd.PersistentFlags().StringVar(&sinceTime, "since-time", "", "Only show containers terminated after a time in RFC3339 format, such as 2023-01-02T15:04:05Z")
+	cmd.PersistentFlags().StringVar(&until, "until", "", "Only show containers terminated before a time in RFC3339 format, such as 2023-01-02T15:04:05Z. Not supported when watching")
+	cmd.Flags().BoolVarP(&watchTerminations, "watch", "w", false, "After listing the OOMKilled containers, watch for new ones as they happen")
+	cmd.Flags().StringVar(&prometheusURL, "prometheus-url", "", "Show the peak memory of each container before it was terminated, and how quickly it grew, from a Prometheus compatible API at this URL")
+	cmd.Flags().StringVar(&prometheusQuery, "prometheus-query", plugin.DefaultPrometheusQuery, "Go template of the query for the memory of a container, given the fields of a termination such as .Namespace, .Pod and .Container")
+	cmd.Flags().Int64Var(&chunkSize, "chunk-size", plugin.DefaultChunkSize, "Return large lists in chunks rather than all at once. Pass 0 to disable.")
+	cmd.PersistentFlags().BoolVar(&strict, "strict", false, "Only show containers killed by the kernel/cgroup OOM killer, ignoring other SIGKILLs such as liveness probe failures")
 	cmd.Flags().BoolVarP(&showVersion, "version", "v", false, "Display version and build information")
+	cmd.PersistentFlags().StringVar(&historySpec, "history", "", "Record terminations in a history store, which is either file:PATH or configmap:[NAMESPACE/]NAME")
 	KubernetesConfigFlags = genericclioptions.NewConfigFlags(true)
-	KubernetesConfigFlags.AddFlags(cmd.Flags())
+	KubernetesConfigFlags.AddFlags(cmd.PersistentFlags())
 
 	viper.SetEnvKeyReplacer(strings.NewReplacer("-", "_"))
 	return cmd
 }
 
+// sortFields returns the fields to sort by from the `--sort-by` flag, or from the
+// older `--sort-field` flag, this is empty when the rows are not sorted.
+func sortFields() ([]plugin.SortField, error) {
+
+	var fields []plugin.SortField
+
+	switch {
+	case sortBy != "" && sortField != sortFieldDefault:
+		return nil, fmt.Errorf("--sort-field cannot be used with --sort-by")
+	case sortBy != "":
+		var err error
+		if fields, err = plugin.ParseSortFields(sortBy); err != nil {
+			return nil, err
+		}
+	case sortField == sortFieldTerminationTime:
+		fields = []plugin.SortField{plugin.SortFieldTime}
+	case sortField != sortFieldDefault:
+		return nil, fmt.Errorf("%s is not a supported sortable field.", sortField)
+	}
+
+	if reverseSort && len(fields) == 0 {
+		return nil, fmt.Errorf("--reverse requires a field to sort by, such as --sort-by time")
+	}
+
+	return fields, nil
+}
+
+// timeWindow returns the time range from the `--since`, `--since-time` and `--until`
+// flags, either end is zero when it is not set.
+func timeWindow() (time.Time, time.Time, error) {
+
+	var from, to time.Time
+
+	switch {
+	case since != 0 && sinceTime != "":
+		return from, to, fmt.Errorf("--since cannot be used with --since-time")
+	case since < 0:
+		return from, to, fmt.Errorf("invalid --since %s, must be a positive duration such as 2h", since)
+	case since > 0:
+		from = time.Now().Add(-since)
+	case sinceTime != "":
+		t, err := time.Parse(time.RFC3339, sinceTime)
+		if err != nil {
+			return from, to, fmt.Errorf("invalid --since-time %q, must be an RFC3339 time such as 2023-01-02T15:04:05Z", sinceTime)
+		}
+		from = t
+	}
+
+	if until != "" {
+		t, err := time.Parse(time.RFC3339, until)
+		if err != nil {
+			return from, to, fmt.Errorf("invalid --until %q, must be an RFC3339 time such as 2023-01-02T15:04:05Z", until)
+		}
+		to = t
+	}
+
+	if !from.IsZero() && !to.IsZero() && to.Before(from) {
+		return from, to, fmt.Errorf("--until %s is before the start of the time window %s", to.Format(time.RFC3339), from.Format(time.RFC3339))
+	}
+
+	return from, to, nil
+}
+
+// checkWatchWindow rejects `--until` for the commands which watch for new
+// terminations, as these happen after the window has closed and the watch would
+// carry on without reporting anything.
+func checkWatchWindow(command string) error {
+	if until != "" {
+		return fmt.Errorf("--until is not supported with %s, as it watches for new terminations", command)
+	}
+	return nil
+}
+
+// parseRequestTimeout parses the `--request-timeout` flag in the same way as
+// kubectl, where a bare integer is a number of seconds and 0 means no timeout.
+func parseRequestTimeout(timeout string) (time.Duration, error) {
+
+	if timeout == "" {
+		return 0, nil
+	}
+
+	if _, err := strconv.Atoi(timeout); err == nil {
+		timeout += "s"
+	}
+
+	d, err := time.ParseDuration(timeout)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid --request-timeout %q, must be a duration such as 1s, 2m or 3h", timeout)
+	}
+
+	return d, nil
+}
+
+// buildOptions returns the options shared by every command from the flags, such
+// as the namespace and selectors. Resources given as arguments are resolved into
+// the targets.
+func buildOptions(factory plugin.ClientFactory, args []string) (plugin.Options, error) {
+
+	// The namespace provided to the flag takes precedence.
+	ns := *KubernetesConfigFlags.Namespace
+
+	namespace, err := plugin.GetNamespace(factory, allNamespaces, ns)
+	if err != nil {
+		return plugin.Options{}, fmt.Errorf("unable to retrieve namespace, got %s: %w", ns, err)
+	}
+
+	var targets []plugin.Target
+	if len(args) > 0 {
+		targets, err = plugin.ResolveTargets(factory, namespace, args)
+		if err != nil {
+			return plugin.Options{}, err
+		}
+	}
+
+	requestTimeout, err := parseRequestTimeout(*KubernetesConfigFlags.Timeout)
+	if err != nil {
+		return plugin.Options{}, err
+	}
+
+	from, to, err := timeWindow()
+	if err != nil {
+		return plugin.Options{}, err
+	}
+
+	return plugin.Options{
+		Namespace:      namespace,
+		LabelSelector:  labelSelector,
+		FieldSelector:  fieldSelector,
+		NodeName:       nodeName,
+		Targets:        targets,
+		ChunkSize:      chunkSize,
+		RequestTimeout: requestTimeout,
+		Classifier:     plugin.DefaultClassifier{Strict: strict},
+		Since:          from,
+		Until:          to,
+	}, nil
+}
+
 func InitAndExecute() {
-	if err := RootCmd().Execute(); err != nil {
+
+	// Cancel any in-flight API calls on Ctrl-C or when terminated, rather than
+	// waiting for a slow List to finish.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+
+	err := RootCmd().ExecuteContext(ctx)
+	stop()
+
+	if err != nil {
 		fmt.Println(err)
 		os.Exit(1)
 	}
@@ -0,0 +1,387 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jdockerty/kubectl-oomd/internal/testutil"
+	"github.com/jdockerty/kubectl-oomd/pkg/plugin"
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/metadata"
+	k8stesting "k8s.io/client-go/testing"
+	metricsv1beta1 "k8s.io/metrics/pkg/apis/metrics/v1beta1"
+	metricsfake "k8s.io/metrics/pkg/client/clientset/versioned/fake"
+)
+
+// runRootCmd executes the root command against a fake clientset containing the
+// given objects, returning what was written to stdout.
+func runRootCmd(t *testing.T, objects []runtime.Object, args ...string) (string, error) {
+	t.Helper()
+
+	var out bytes.Buffer
+	err := runRootCmdClients(context.Background(), &out, fake.NewSimpleClientset(objects...), testutil.MetadataClient(objects...), args...)
+	return out.String(), err
+}
+
+// runRootCmdContext executes the root command against the given client, until
+// the context is cancelled.
+func runRootCmdContext(ctx context.Context, out io.Writer, client kubernetes.Interface, args ...string) error {
+	return runRootCmdClients(ctx, out, client, nil, args...)
+}
+
+// runRootCmdClients executes the root command against the given clients, the
+// metadata client is used to resolve the owners of pods and may be nil.
+func runRootCmdClients(ctx context.Context, out io.Writer, client kubernetes.Interface, metadataClient metadata.Interface, args ...string) error {
+
+	newClientFactory = func(configFlags *genericclioptions.ConfigFlags) plugin.ClientFactory {
+		return testutil.ClientFactory{RESTClientGetter: configFlags, Client: client, Metadata: metadataClient}
+	}
+	defer func() { newClientFactory = plugin.NewClientFactory }()
+
+	cmd := RootCmd()
+	cmd.SetOut(out)
+	cmd.SetArgs(args)
+
+	return cmd.ExecuteContext(ctx)
+}
+
+func TestRootCmd(t *testing.T) {
+
+	objects := []runtime.Object{
+		testutil.Pod("shop", "checkout-1", 137, "OOMKilled"),
+		testutil.Pod("shop", "checkout-2", 137, "Error"),
+		testutil.Pod("shop", "checkout-3", 0, "Completed"),
+		testutil.Pod("other", "payments-1", 137, "OOMKilled"),
+	}
+
+	tests := map[string]struct {
+		args []string
+		want string
+	}{
+		"namespace": {
+			args: []string{"-n", "shop"},
+			want: "POD            CONTAINER     TYPE          STATE     CATEGORY      REQUEST     LIMIT     USAGE         % OF LIMIT     TERMINATION TIME\n" +
+				"checkout-1     app           Container     Last      OOMKilled     0           128Mi     <unknown>     <unknown>      0001-01-01 00:00:00 +0000 UTC\n" +
+				"checkout-2     app           Container     Last      SIGKILL       0           128Mi     <unknown>     <unknown>      0001-01-01 00:00:00 +0000 UTC\n",
+		},
+		"strict without headers": {
+			args: []string{"-n", "shop", "--strict", "--no-headers"},
+			want: "checkout-1     app       Container     Last      OOMKilled     0         128Mi     <unknown>     <unknown>     0001-01-01 00:00:00 +0000 UTC\n",
+		},
+		"all namespaces": {
+			args: []string{"-A", "-o", "custom-columns=NAMESPACE:.namespace,POD:.pod,CATEGORY:.category"},
+			want: "NAMESPACE   POD          CATEGORY\n" +
+				"other       payments-1   OOMKilled\n" +
+				"shop        checkout-1   OOMKilled\n" +
+				"shop        checkout-2   SIGKILL\n",
+		},
+		"jsonpath": {
+			args: []string{"-n", "shop", "-o", `jsonpath={.items[*].pod}`},
+			want: "checkout-1 checkout-2",
+		},
+		"no pods in namespace": {
+			args: []string{"-n", "empty"},
+			want: "No out of memory pods found in empty namespace.\n",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			out, err := runRootCmd(t, objects, tc.args...)
+			assert.Nil(t, err)
+			assert.Equal(t, tc.want, out)
+		})
+	}
+}
+
+func TestRootCmdJSON(t *testing.T) {
+
+	out, err := runRootCmd(t, []runtime.Object{testutil.Pod("shop", "checkout-1", 137, "OOMKilled")}, "-n", "shop", "-o", "json")
+	assert.Nil(t, err)
+
+	var list plugin.TerminationList
+	assert.Nil(t, json.Unmarshal([]byte(out), &list))
+
+	assert.Equal(t, plugin.TerminationListKind, list.Kind)
+	assert.Equal(t, 1, len(list.Items))
+	assert.Equal(t, "checkout-1", list.Items[0].Pod)
+	assert.Equal(t, int64(128*1024*1024), list.Items[0].Memory.Limit.Bytes)
+}
+
+func TestRootCmdOwners(t *testing.T) {
+
+	controller := true
+	pod := testutil.Pod("shop", "checkout-5bcbcdf97-x2k8p", 137, "OOMKilled")
+	pod.OwnerReferences = []metav1.OwnerReference{{APIVersion: "apps/v1", Kind: "ReplicaSet", Name: "checkout-5bcbcdf97", Controller: &controller}}
+	replicaSet := &appsv1.ReplicaSet{ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "checkout-5bcbcdf97", OwnerReferences: []metav1.OwnerReference{{APIVersion: "apps/v1", Kind: "Deployment", Name: "checkout", Controller: &controller}}}}
+
+	tests := map[string]struct {
+		args       []string
+		wantOwners bool
+	}{
+		"table": {
+			args: []string{"-n", "shop"},
+		},
+		"wide": {
+			args: []string{"-n", "shop", "-o", "wide"},
+		},
+		"structured": {
+			args:       []string{"-n", "shop", "-o", "jsonpath={.items[*].owner}"},
+			wantOwners: true,
+		},
+	}
+
+	// The owners are only resolved when they are shown, as this lists the owners
+	// of the pods.
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			metadataClient := testutil.MetadataClient(replicaSet)
+
+			var out bytes.Buffer
+			err := runRootCmdClients(context.Background(), &out, fake.NewSimpleClientset(pod), metadataClient, tc.args...)
+			assert.Nil(t, err)
+			assert.Equal(t, tc.wantOwners, len(metadataClient.Actions()) > 0)
+
+			if tc.wantOwners {
+				assert.Equal(t, "Deployment/checkout", out.String())
+			}
+		})
+	}
+}
+
+func TestRootCmdEmptyJSON(t *testing.T) {
+
+	out, err := runRootCmd(t, nil, "-n", "empty", "-o", "json")
+	assert.Nil(t, err)
+
+	var list plugin.TerminationList
+	assert.Nil(t, json.Unmarshal([]byte(out), &list))
+	assert.NotNil(t, list.Items, "an empty result should still be a list")
+	assert.Equal(t, 0, len(list.Items))
+}
+
+func TestRootCmdMemoryUsage(t *testing.T) {
+
+	metrics := metricsfake.NewSimpleClientset()
+	metrics.PrependReactor("list", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, &metricsv1beta1.PodMetricsList{Items: []metricsv1beta1.PodMetrics{{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "checkout-1"},
+			Containers: []metricsv1beta1.ContainerMetrics{{
+				Name:  "app",
+				Usage: v1.ResourceList{v1.ResourceMemory: resource.MustParse("96Mi")},
+			}},
+		}}}, nil
+	})
+
+	client := fake.NewSimpleClientset(testutil.Pod("shop", "checkout-1", 137, "OOMKilled"), testutil.Pod("shop", "checkout-2", 137, "OOMKilled"))
+
+	newClientFactory = func(configFlags *genericclioptions.ConfigFlags) plugin.ClientFactory {
+		return testutil.ClientFactory{RESTClientGetter: configFlags, Client: client, Metrics: metrics}
+	}
+	defer func() { newClientFactory = plugin.NewClientFactory }()
+
+	var out bytes.Buffer
+	cmd := RootCmd()
+	cmd.SetOut(&out)
+	cmd.SetArgs([]string{"-n", "shop", "--no-headers"})
+
+	assert.Nil(t, cmd.Execute())
+	assert.Equal(t, "checkout-1     app       Container     Last      OOMKilled     0         128Mi     96Mi          75%           0001-01-01 00:00:00 +0000 UTC\n"+
+		"checkout-2     app       Container     Last      OOMKilled     0         128Mi     <unknown>     <unknown>     0001-01-01 00:00:00 +0000 UTC\n", out.String())
+}
+
+func TestRootCmdPrometheus(t *testing.T) {
+
+	// A container which grew from 64Mi to 128Mi over a minute before it was killed.
+	prometheus := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"status":"success","data":{"resultType":"matrix","result":[{"metric":{},"values":[[1672628400,"67108864"],[1672628460,"134217728"]]}]}}`)
+	}))
+	defer prometheus.Close()
+
+	pod := testutil.Pod("shop", "checkout-1", 137, "OOMKilled")
+	terminated := pod.Status.ContainerStatuses[0].LastTerminationState.Terminated
+	terminated.StartedAt = metav1.NewTime(time.Date(2023, 1, 2, 3, 0, 0, 0, time.UTC))
+	terminated.FinishedAt = metav1.NewTime(time.Date(2023, 1, 2, 3, 1, 0, 0, time.UTC))
+
+	out, err := runRootCmd(t, []runtime.Object{pod}, "-n", "shop", "--prometheus-url", prometheus.URL, "-o", "custom-columns=POD:.pod,PEAK:.memory.peak.quantity,GROWTH:.memory.growthPerMinute.quantity")
+	assert.Nil(t, err)
+	assert.Equal(t, "POD          PEAK    GROWTH\n"+
+		"checkout-1   128Mi   64Mi\n", out)
+
+	_, err = runRootCmd(t, []runtime.Object{pod}, "-n", "shop", "--prometheus-url", prometheus.URL, "--prometheus-query", "{{ .Wat }}")
+	assert.NotNil(t, err)
+}
+
+func TestRootCmdSortBy(t *testing.T) {
+
+	pod := func(name, limit string, hour int) runtime.Object {
+		p := testutil.Pod("shop", name, 137, "OOMKilled")
+		p.Spec.Containers[0].Resources.Limits[v1.ResourceMemory] = resource.MustParse(limit)
+		p.Status.ContainerStatuses[0].LastTerminationState.Terminated.FinishedAt = metav1.NewTime(time.Date(2023, 1, 2, hour, 0, 0, 0, time.UTC))
+		return p
+	}
+
+	// Compared as strings, 1100M would sort before 1Gi.
+	objects := []runtime.Object{pod("checkout-1", "1Gi", 3), pod("checkout-2", "512Mi", 1), pod("checkout-3", "1100M", 2), pod("checkout-4", "1Gi", 0)}
+
+	tests := map[string]struct {
+		args []string
+		want string
+	}{
+		"limit and time": {
+			args: []string{"--sort-by", "limit,time"},
+			want: "checkout-2 512Mi\ncheckout-4 1Gi\ncheckout-1 1Gi\ncheckout-3 1100M\n",
+		},
+		"reverse": {
+			args: []string{"--sort-by", "limit,time", "--reverse"},
+			want: "checkout-3 1100M\ncheckout-1 1Gi\ncheckout-4 1Gi\ncheckout-2 512Mi\n",
+		},
+		"sort field": {
+			args: []string{"--sort-field", "time", "--reverse"},
+			want: "checkout-1 1Gi\ncheckout-3 1100M\ncheckout-2 512Mi\ncheckout-4 1Gi\n",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			args := append([]string{"-n", "shop", "-o", `jsonpath={range .items[*]}{.pod} {.memory.limit.quantity}{"\n"}{end}`}, tc.args...)
+			out, err := runRootCmd(t, objects, args...)
+			assert.Nil(t, err)
+			assert.Equal(t, tc.want, out)
+		})
+	}
+}
+
+func TestRootCmdTimeWindow(t *testing.T) {
+
+	pod := func(name string, finished time.Time) runtime.Object {
+		p := testutil.Pod("shop", name, 137, "OOMKilled")
+		p.Status.ContainerStatuses[0].LastTerminationState.Terminated.FinishedAt = metav1.NewTime(finished)
+		return p
+	}
+
+	objects := []runtime.Object{
+		pod("checkout-1", time.Date(2023, 1, 2, 0, 0, 0, 0, time.UTC)),
+		pod("checkout-2", time.Date(2023, 1, 2, 12, 0, 0, 0, time.UTC)),
+		pod("checkout-3", time.Now().Add(-time.Hour)),
+	}
+
+	tests := map[string]struct {
+		args []string
+		want string
+	}{
+		"since": {
+			args: []string{"--since", "2h"},
+			want: "checkout-3\n",
+		},
+		"since time": {
+			args: []string{"--since-time", "2023-01-02T06:00:00Z"},
+			want: "checkout-2\ncheckout-3\n",
+		},
+		"since time and until": {
+			args: []string{"--since-time", "2023-01-02T00:00:00Z", "--until", "2023-01-02T12:00:00Z"},
+			want: "checkout-1\ncheckout-2\n",
+		},
+		"until": {
+			args: []string{"--until", "2023-01-02T06:00:00Z"},
+			want: "checkout-1\n",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			args := append([]string{"-n", "shop", "--sort-by", "time", "-o", `jsonpath={range .items[*]}{.pod}{"\n"}{end}`}, tc.args...)
+			out, err := runRootCmd(t, objects, args...)
+			assert.Nil(t, err)
+			assert.Equal(t, tc.want, out)
+		})
+	}
+
+	out, err := runRootCmd(t, objects, "-n", "shop", "--until", "2022-01-01T00:00:00Z")
+	assert.Nil(t, err)
+	assert.Equal(t, "No out of memory pods found in shop namespace.\n", out)
+}
+
+func TestRootCmdInvalidFlags(t *testing.T) {
+
+	_, err := runRootCmd(t, nil, "-n", "shop", "--sort-field", "wat")
+	assert.NotNil(t, err)
+
+	_, err = runRootCmd(t, nil, "-n", "shop", "--sort-by", "memory")
+	assert.NotNil(t, err)
+
+	_, err = runRootCmd(t, nil, "-n", "shop", "--sort-by", "limit", "--sort-field", "time")
+	assert.NotNil(t, err)
+
+	_, err = runRootCmd(t, nil, "-n", "shop", "--reverse")
+	assert.NotNil(t, err)
+
+	_, err = runRootCmd(t, nil, "-n", "shop", "--since", "2h", "--since-time", "2023-01-02T15:04:05Z")
+	assert.NotNil(t, err)
+
+	_, err = runRootCmd(t, nil, "-n", "shop", "--since", "-2h")
+	assert.NotNil(t, err)
+
+	_, err = runRootCmd(t, nil, "-n", "shop", "--since-time", "yesterday")
+	assert.NotNil(t, err)
+
+	_, err = runRootCmd(t, nil, "-n", "shop", "--since-time", "2023-01-02T15:04:05Z", "--until", "2023-01-01T15:04:05Z")
+	assert.NotNil(t, err)
+
+	_, err = runRootCmd(t, nil, "-n", "shop", "-o", "wat")
+	assert.NotNil(t, err)
+
+	_, err = runRootCmd(t, nil, "-n", "shop", "--request-timeout", "soon")
+	assert.NotNil(t, err)
+
+	_, err = runRootCmd(t, nil, "-n", "shop", "--watch", "--prometheus-url", "http://prometheus:9090")
+	assert.NotNil(t, err)
+
+	_, err = runRootCmd(t, nil, "-n", "shop", "--watch", "--until", "2023-01-02T15:04:05Z")
+	assert.NotNil(t, err)
+}
+
+func TestParseRequestTimeout(t *testing.T) {
+
+	tests := map[string]struct {
+		timeout string
+		want    time.Duration
+		wantErr bool
+	}{
+		"default":          {timeout: "0", want: 0},
+		"empty":            {timeout: "", want: 0},
+		"bare seconds":     {timeout: "30", want: 30 * time.Second},
+		"duration":         {timeout: "1m30s", want: 90 * time.Second},
+		"negative":         {timeout: "-1s", wantErr: true},
+		"invalid duration": {timeout: "soon", wantErr: true},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+
+			got, err := parseRequestTimeout(tc.timeout)
+			if tc.wantErr {
+				assert.NotNil(t, err)
+				return
+			}
+
+			assert.Nil(t, err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/jdockerty/kubectl-oomd/pkg/plugin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/spf13/cobra"
+)
+
+// Provides the `--metrics-addr` flag, the address which metrics are served on.
+var metricsAddr string
+
+// shutdownTimeout is how long in-flight scrapes are given to finish on shutdown.
+const shutdownTimeout = 5 * time.Second
+
+func serveCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "serve",
+		Short: "Serve Prometheus metrics for OOMKilled containers",
+		Long: `Watch for containers which have been terminated by Kubernetes due to an 'Out Of Memory' error
+and serve them as Prometheus metrics, on the '/metrics' path.
+
+The existing terminations are counted when the exporter starts, so counters begin at the number of
+terminations which are still visible in the pods' status.`,
+		Args:          cobra.NoArgs,
+		SilenceErrors: true,
+		SilenceUsage:  true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+
+			if err := checkWatchWindow("serve"); err != nil {
+				return err
+			}
+
+			factory := newClientFactory(KubernetesConfigFlags)
+
+			opts, err := buildOptions(factory, nil)
+			if err != nil {
+				return err
+			}
+			opts.OnWatchError = func(err error) {
+				fmt.Fprintln(cmd.ErrOrStderr(), err)
+			}
+
+			// The owner of each termination is a label of the metrics.
+			if opts.Owners, err = plugin.NewOwnerResolver(factory); err != nil {
+				return err
+			}
+
+			client, err := factory.KubernetesClient()
+			if err != nil {
+				return err
+			}
+
+			store, err := openHistory(factory)
+			if err != nil {
+				return err
+			}
+
+			registry := prometheus.NewRegistry()
+			metrics, err := plugin.NewMetrics(registry)
+			if err != nil {
+				return err
+			}
+
+			// Listening before the watch starts surfaces errors, such as the address
+			// already being in use, straight away.
+			listener, err := net.Listen("tcp", metricsAddr)
+			if err != nil {
+				return fmt.Errorf("unable to listen on %s: %w", metricsAddr, err)
+			}
+
+			return serveMetrics(cmd.Context(), listener, registry, func(ctx context.Context) error {
+				return plugin.WatchWithHandler(ctx, client, opts, recordHistory(ctx, store, cmd.ErrOrStderr(), metrics))
+			})
+		},
+	}
+
+	cmd.Flags().StringVar(&metricsAddr, "metrics-addr", ":9090", "The address to serve metrics on")
+
+	return cmd
+}
+
+// serveMetrics serves the registry's metrics on the listener whilst watch runs,
+// shutting down the server when the watch stops or the context is cancelled.
+func serveMetrics(ctx context.Context, listener net.Listener, registry *prometheus.Registry, watch func(context.Context) error) error {
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	serveErr := make(chan error, 1)
+	go func() {
+		defer cancel()
+		serveErr <- server.Serve(listener)
+	}()
+
+	watchErr := watch(ctx)
+
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer shutdownCancel()
+
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		return err
+	}
+
+	if err := <-serveErr; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	return watchErr
+}
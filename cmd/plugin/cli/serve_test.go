@@ -0,0 +1,75 @@
+package cli
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jdockerty/kubectl-oomd/internal/testutil"
+	"github.com/jdockerty/kubectl-oomd/pkg/plugin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestServeMetrics(t *testing.T) {
+
+	client := fake.NewSimpleClientset(testutil.Pod("shop", "checkout-1", 137, "OOMKilled"))
+
+	registry := prometheus.NewRegistry()
+	metrics, err := plugin.NewMetrics(registry)
+	assert.Nil(t, err)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	done := make(chan error)
+	go func() {
+		done <- serveMetrics(ctx, listener, registry, func(ctx context.Context) error {
+			return plugin.WatchWithHandler(ctx, client, plugin.Options{Namespace: "shop"}, metrics)
+		})
+	}()
+
+	want := `oomd_container_oom_kills_total{container="app",namespace="shop",owner="",pod="checkout-1"} 1`
+
+	var body string
+	deadline := time.Now().Add(5 * time.Second)
+	for !strings.Contains(body, want) {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for metrics, got:\n%s", body)
+		}
+		time.Sleep(10 * time.Millisecond)
+
+		resp, err := http.Get("http://" + listener.Addr().String() + "/metrics")
+		if err != nil {
+			continue
+		}
+		b, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		body = string(b)
+	}
+
+	assert.Contains(t, body, `oomd_container_memory_limit_bytes{container="app",namespace="shop",owner="",pod="checkout-1"} 1.34217728e+08`)
+
+	cancel()
+	assert.Nil(t, <-done)
+}
+
+func TestServeCmdInvalid(t *testing.T) {
+
+	_, err := runRootCmd(t, nil, "serve", "deploy/checkout")
+	assert.NotNil(t, err, "serve does not accept resources as arguments")
+
+	_, err = runRootCmd(t, nil, "serve", "--metrics-addr", "not-an-address")
+	assert.NotNil(t, err)
+
+	_, err = runRootCmd(t, nil, "serve", "--until", "2023-01-02T15:04:05Z")
+	assert.NotNil(t, err, "serve would never report a termination before --until")
+}
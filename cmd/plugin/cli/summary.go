@@ -0,0 +1,158 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/jdockerty/kubectl-oomd/pkg/plugin"
+	"github.com/spf13/cobra"
+)
+
+// Provides the `--top` flag, the number of rows shown in each table of the summary.
+var summaryTop int
+
+func summaryCmd() *cobra.Command {
+
+	printFlags := newPrintFlags()
+
+	cmd := &cobra.Command{
+		Use:   "summary [TYPE/NAME ...]",
+		Short: "Count OOMKilled containers by namespace, workload, node and image",
+		Long: `Count the containers which were terminated by Kubernetes due to an 'Out Of Memory' error, by
+namespace, the workload which owns their pod, node and container image, with the most first.
+
+This shows the shape of the problem across a large cluster on one screen, such as a single node or a new
+image, before drilling into the individual terminations.`,
+		Args:          cobra.ArbitraryArgs,
+		SilenceErrors: true,
+		SilenceUsage:  true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+
+			out := cmd.OutOrStdout()
+
+			if summaryTop < 0 {
+				return fmt.Errorf("invalid --top %d, must be 0 or greater", summaryTop)
+			}
+
+			printer, err := printFlags.toPrinter(false)
+			if err != nil {
+				return err
+			}
+
+			factory := newClientFactory(KubernetesConfigFlags)
+
+			opts, err := buildOptions(factory, args)
+			if err != nil {
+				return err
+			}
+
+			// The terminations are counted by the workload which owns each pod.
+			if opts.Owners, err = plugin.NewOwnerResolver(factory); err != nil {
+				return err
+			}
+
+			oomPods, err := plugin.Run(cmd.Context(), factory, opts)
+			if err != nil {
+				return err
+			}
+
+			summary, err := plugin.Summarize(cmd.Context(), opts.Owners, oomPods)
+			if err != nil {
+				return err
+			}
+
+			if printer != nil {
+				return printer.PrintObj(summary, out)
+			}
+
+			if summary.Total == 0 {
+				if allNamespaces {
+					fmt.Fprintln(out, "No out of memory pods found.")
+					return nil
+				}
+				fmt.Fprintf(out, "No out of memory pods found in %s namespace.\n", opts.Namespace)
+				return nil
+			}
+
+			tables := []summaryTable{
+				{header: "WORKLOAD", counts: summary.Workloads, namespaced: allNamespaces},
+				{header: "NODE", counts: summary.Nodes},
+				{header: "IMAGE", counts: summary.Images},
+			}
+
+			// The namespace is already known without `--all-namespaces`.
+			if allNamespaces {
+				tables = append([]summaryTable{{header: "NAMESPACE", counts: summary.Namespaces}}, tables...)
+			}
+
+			for i, table := range tables {
+				if i > 0 {
+					fmt.Fprintln(out)
+				}
+
+				t := tabwriter.NewWriter(out, 10, 1, 5, ' ', 0)
+				if err := printSummaryTable(t, table, summaryTop); err != nil {
+					return err
+				}
+				if err := t.Flush(); err != nil {
+					return err
+				}
+			}
+
+			return nil
+		},
+	}
+
+	printFlags.addFlags(cmd)
+	cmd.Flags().IntVar(&summaryTop, "top", 10, "Number of rows shown in each table, the rest are combined into a single row. Pass 0 to show every row.")
+
+	return cmd
+}
+
+// summaryTable is a single table of the summary, such as the count per node.
+type summaryTable struct {
+	header string
+	counts []plugin.Count
+
+	// namespaced adds a namespace column, for the workloads across all namespaces.
+	namespaced bool
+}
+
+// printSummaryTable writes the counts of the table, only the top rows are shown
+// and the remaining counts are combined into a final row.
+func printSummaryTable(w io.Writer, table summaryTable, top int) error {
+
+	headers := []string{table.header, "OOMS"}
+	if table.namespaced {
+		headers = append([]string{"NAMESPACE"}, headers...)
+	}
+
+	if _, err := fmt.Fprintln(w, strings.Join(headers, "\t")); err != nil {
+		return err
+	}
+
+	counts := table.counts
+	if top > 0 && len(counts) > top {
+		rest := plugin.Count{Name: fmt.Sprintf("<%d more>", len(counts)-top)}
+		for _, c := range counts[top:] {
+			rest.Count += c.Count
+		}
+		counts = append(counts[:top:top], rest)
+	}
+
+	for _, c := range counts {
+		values := []string{valueOrNone(c.Name), strconv.Itoa(c.Count)}
+		if table.namespaced {
+			values = append([]string{c.Namespace}, values...)
+		}
+
+		if _, err := fmt.Fprintln(w, strings.Join(values, "\t")); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,92 @@
+package cli
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/jdockerty/kubectl-oomd/internal/testutil"
+	"github.com/jdockerty/kubectl-oomd/pkg/plugin"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestSummary(t *testing.T) {
+
+	pod := func(namespace, name, node, image string) *v1.Pod {
+		p := testutil.Pod(namespace, name, 137, "OOMKilled")
+		p.Spec.NodeName = node
+		p.Status.ContainerStatuses[0].Image = image
+		return p
+	}
+
+	objects := []runtime.Object{
+		pod("shop", "checkout-1", "node-a", "checkout:1.2"),
+		pod("shop", "checkout-2", "node-b", "checkout:1.2"),
+		pod("shop", "checkout-3", "node-a", "checkout:1.3"),
+		pod("other", "payments-1", "node-a", "payments:2.0"),
+	}
+
+	tests := map[string]struct {
+		args []string
+		want string
+	}{
+		"namespace": {
+			args: []string{"summary", "-n", "shop"},
+			want: "WORKLOAD           OOMS\n" +
+				"Pod/checkout-1     1\n" +
+				"Pod/checkout-2     1\n" +
+				"Pod/checkout-3     1\n" +
+				"\n" +
+				"NODE       OOMS\n" +
+				"node-a     2\n" +
+				"node-b     1\n" +
+				"\n" +
+				"IMAGE            OOMS\n" +
+				"checkout:1.2     2\n" +
+				"checkout:1.3     1\n",
+		},
+		"all namespaces with top": {
+			args: []string{"summary", "-A", "--top", "1"},
+			want: "NAMESPACE     OOMS\n" +
+				"shop          3\n" +
+				"<1 more>      1\n" +
+				"\n" +
+				"NAMESPACE     WORKLOAD           OOMS\n" +
+				"other         Pod/payments-1     1\n" +
+				"              <3 more>           3\n" +
+				"\n" +
+				"NODE         OOMS\n" +
+				"node-a       3\n" +
+				"<1 more>     1\n" +
+				"\n" +
+				"IMAGE            OOMS\n" +
+				"checkout:1.2     2\n" +
+				"<2 more>         2\n",
+		},
+		"no pods in namespace": {
+			args: []string{"summary", "-n", "empty"},
+			want: "No out of memory pods found in empty namespace.\n",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			out, err := runRootCmd(t, objects, tc.args...)
+			assert.Nil(t, err)
+			assert.Equal(t, tc.want, out)
+		})
+	}
+
+	out, err := runRootCmd(t, objects, "summary", "-A", "-o", "json")
+	assert.Nil(t, err)
+
+	var summary plugin.Summary
+	assert.Nil(t, json.Unmarshal([]byte(out), &summary))
+	assert.Equal(t, plugin.SummaryKind, summary.Kind)
+	assert.Equal(t, 4, summary.Total)
+	assert.Equal(t, plugin.Count{Name: "node-a", Count: 3}, summary.Nodes[0])
+
+	_, err = runRootCmd(t, objects, "summary", "-n", "shop", "--top", "-1")
+	assert.NotNil(t, err)
+}
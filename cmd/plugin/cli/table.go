@@ -0,0 +1,174 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/jdockerty/kubectl-oomd/pkg/plugin"
+	"k8s.io/apimachinery/pkg/util/duration"
+)
+
+// tableColumn is a single column of the table output, along with how its value
+// is retrieved for each terminated pod.
+type tableColumn struct {
+	header string
+	value  func(p plugin.TerminatedPodInfo) string
+}
+
+var (
+	// When using the `all-namespaces` flag, we must show which namespace the pod was in, this becomes an extra column.
+	namespaceColumn = tableColumn{"NAMESPACE", func(p plugin.TerminatedPodInfo) string { return p.Pod.Namespace }}
+
+	// The columns which are always shown.
+	defaultColumns = []tableColumn{
+		{"POD", func(p plugin.TerminatedPodInfo) string { return p.Pod.Name }},
+		{"CONTAINER", func(p plugin.TerminatedPodInfo) string { return p.ContainerName }},
+		{"TYPE", func(p plugin.TerminatedPodInfo) string { return string(p.ContainerType) }},
+		{"STATE", func(p plugin.TerminatedPodInfo) string { return string(p.State) }},
+		{"CATEGORY", func(p plugin.TerminatedPodInfo) string { return string(p.Category) }},
+		{"REQUEST", func(p plugin.TerminatedPodInfo) string { return p.Memory.Request }},
+		{"LIMIT", func(p plugin.TerminatedPodInfo) string { return p.Memory.Limit }},
+	}
+
+	// The current memory usage of the restarted container, alongside its request and limit.
+	// This is unknown when the metrics API is unavailable.
+	usageColumns = []tableColumn{
+		{"USAGE", func(p plugin.TerminatedPodInfo) string { return valueOrUnknown(p.Memory.Usage) }},
+		{"% OF LIMIT", func(p plugin.TerminatedPodInfo) string {
+			if percentage, ok := p.Memory.UsagePercentage(); ok {
+				return fmt.Sprintf("%.0f%%", percentage)
+			}
+			if p.Memory.Usage != "" {
+				return "<none>"
+			}
+			return "<unknown>"
+		}},
+	}
+
+	// The memory of the container leading up to its termination, from Prometheus.
+	peakColumns = []tableColumn{
+		{"PEAK", func(p plugin.TerminatedPodInfo) string { return valueOrUnknown(p.Memory.Peak) }},
+		{"GROWTH/MIN", func(p plugin.TerminatedPodInfo) string { return valueOrUnknown(p.Memory.GrowthPerMinute) }},
+	}
+
+	terminationTimeColumn = tableColumn{"TERMINATION TIME", func(p plugin.TerminatedPodInfo) string { return p.TerminatedTime }}
+
+	// Extra columns shown with `-o wide`, these provide enough detail to triage
+	// a termination without running `kubectl describe` against the pod.
+	wideColumns = []tableColumn{
+		{"NODE", func(p plugin.TerminatedPodInfo) string { return valueOrNone(p.Pod.Spec.NodeName) }},
+		{"QOS", func(p plugin.TerminatedPodInfo) string { return valueOrNone(string(p.Pod.Status.QOSClass)) }},
+		{"RESTARTS", func(p plugin.TerminatedPodInfo) string {
+			status, _ := p.ContainerStatus()
+			return strconv.Itoa(int(status.RestartCount))
+		}},
+		{"IMAGE", func(p plugin.TerminatedPodInfo) string {
+			status, _ := p.ContainerStatus()
+			return valueOrNone(status.Image)
+		}},
+		{"EXIT CODE", func(p plugin.TerminatedPodInfo) string {
+			if terminated := p.Termination(); terminated != nil {
+				return strconv.Itoa(int(terminated.ExitCode))
+			}
+			return "<unknown>"
+		}},
+		{"REASON", func(p plugin.TerminatedPodInfo) string {
+			if terminated := p.Termination(); terminated != nil {
+				return valueOrNone(terminated.Reason)
+			}
+			return "<unknown>"
+		}},
+		{"RAN FOR", func(p plugin.TerminatedPodInfo) string {
+			if d := p.RunDuration(); d > 0 {
+				return duration.HumanDuration(d)
+			}
+			return "<unknown>"
+		}},
+		{"MESSAGE", func(p plugin.TerminatedPodInfo) string {
+			if terminated := p.Termination(); terminated != nil {
+				// Messages may span multiple lines, which would break the table.
+				return valueOrNone(strings.Join(strings.Fields(terminated.Message), " "))
+			}
+			return "<unknown>"
+		}},
+	}
+)
+
+// valueOrNone replaces an empty value, similar to how `kubectl` displays unset fields.
+func valueOrNone(value string) string {
+	if value == "" {
+		return "<none>"
+	}
+	return value
+}
+
+// valueOrUnknown replaces an empty value which could not be retrieved, such as
+// the memory usage without metrics-server.
+func valueOrUnknown(value string) string {
+	if value == "" {
+		return "<unknown>"
+	}
+	return value
+}
+
+// tableColumns returns the columns to display, based on the provided flags. The
+// usage and peak columns are only shown when they have been retrieved.
+func tableColumns(allNamespaces, wide, usage, peak bool) []tableColumn {
+
+	var columns []tableColumn
+
+	if allNamespaces {
+		columns = append(columns, namespaceColumn)
+	}
+
+	columns = append(columns, defaultColumns...)
+
+	if usage {
+		columns = append(columns, usageColumns...)
+	}
+
+	if peak {
+		columns = append(columns, peakColumns...)
+	}
+
+	columns = append(columns, terminationTimeColumn)
+
+	if wide {
+		columns = append(columns, wideColumns...)
+	}
+
+	return columns
+}
+
+// printTable writes the terminated pods as tab separated columns, this is expected
+// to be a tabwriter so that the columns are aligned.
+func printTable(w io.Writer, pods plugin.TerminatedPods, columns []tableColumn, noHeaders bool) error {
+
+	if !noHeaders {
+		headers := make([]string, 0, len(columns))
+		for _, c := range columns {
+			headers = append(headers, c.header)
+		}
+
+		_, err := fmt.Fprintln(w, strings.Join(headers, "\t"))
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, p := range pods {
+		values := make([]string, 0, len(columns))
+		for _, c := range columns {
+			values = append(values, c.value(p))
+		}
+
+		_, err := fmt.Fprintln(w, strings.Join(values, "\t"))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,91 @@
+package cli
+
+import (
+	"bytes"
+	"testing"
+	"text/tabwriter"
+
+	"github.com/jdockerty/kubectl-oomd/pkg/plugin"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestPrintTable(t *testing.T) {
+
+	pods := plugin.TerminatedPods{
+		plugin.TerminatedPodInfo{
+			Pod: v1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: "my-app", Namespace: "oomkilled"},
+				Spec:       v1.PodSpec{NodeName: "node-1"},
+				Status: v1.PodStatus{
+					QOSClass: v1.PodQOSBurstable,
+					ContainerStatuses: []v1.ContainerStatus{
+						{
+							Name:         "infoapp",
+							Image:        "infoapp:v1",
+							RestartCount: 3,
+							LastTerminationState: v1.ContainerState{
+								Terminated: &v1.ContainerStateTerminated{ExitCode: 137, Reason: "OOMKilled", Message: "killed\nby the kernel"},
+							},
+						},
+					},
+				},
+			},
+			ContainerName:  "infoapp",
+			ContainerType:  plugin.ContainerTypeRegular,
+			State:          plugin.TerminationStateLast,
+			Category:       plugin.CategoryOOMKilled,
+			Memory:         plugin.MemoryInfo{Request: "1G", Limit: "8G"},
+			TerminatedTime: "2022-11-07 13:03:49 +0000 GMT",
+		},
+	}
+
+	tests := map[string]struct {
+		allNamespaces bool
+		wide          bool
+		usage         bool
+		peak          bool
+		noHeaders     bool
+		want          string
+	}{
+		"default": {
+			want: "POD    CONTAINER TYPE      STATE CATEGORY  REQUEST LIMIT TERMINATION TIME\n" +
+				"my-app infoapp   Container Last  OOMKilled 1G      8G    2022-11-07 13:03:49 +0000 GMT\n",
+		},
+		"all namespaces without headers": {
+			allNamespaces: true,
+			noHeaders:     true,
+			want:          "oomkilled my-app infoapp Container Last OOMKilled 1G 8G 2022-11-07 13:03:49 +0000 GMT\n",
+		},
+		"unknown usage": {
+			usage:     true,
+			noHeaders: true,
+			want:      "my-app infoapp Container Last OOMKilled 1G 8G <unknown> <unknown> 2022-11-07 13:03:49 +0000 GMT\n",
+		},
+		"unknown peak": {
+			peak:      true,
+			noHeaders: true,
+			want:      "my-app infoapp Container Last OOMKilled 1G 8G <unknown> <unknown> 2022-11-07 13:03:49 +0000 GMT\n",
+		},
+		"wide": {
+			wide:      true,
+			noHeaders: true,
+			want:      "my-app infoapp Container Last OOMKilled 1G 8G 2022-11-07 13:03:49 +0000 GMT node-1 Burstable 3 infoapp:v1 137 OOMKilled <unknown> killed by the kernel\n",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+
+			var buf bytes.Buffer
+			w := tabwriter.NewWriter(&buf, 0, 1, 1, ' ', 0)
+
+			err := printTable(w, pods, tableColumns(tc.allNamespaces, tc.wide, tc.usage, tc.peak), tc.noHeaders)
+			assert.Nil(t, err)
+			w.Flush()
+
+			assert.Equal(t, tc.want, buf.String())
+		})
+	}
+}
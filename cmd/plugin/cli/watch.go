@@ -0,0 +1,71 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/jdockerty/kubectl-oomd/pkg/plugin"
+)
+
+// runWatch prints the terminated containers as they happen, until the context is
+// cancelled. Each termination is printed on its own, either as a table row or as a
+// single object for structured output, similar to `kubectl get --watch`.
+func runWatch(ctx context.Context, out, errOut io.Writer, factory plugin.ClientFactory, store plugin.HistoryStore, opts plugin.Options) error {
+
+	client, err := factory.KubernetesClient()
+	if err != nil {
+		return err
+	}
+
+	// Headers are printed straight away, so that it is clear the watch has started.
+	// The usage is not retrieved, as it is not yet known just after a termination.
+	t := tabwriter.NewWriter(out, 10, 1, 5, ' ', 0)
+	columns := tableColumns(allNamespaces, outputFlags.outputFormat == outputFormatWide, false, false)
+
+	printer, err := outputFlags.toPrinter(noHeaders)
+	if err != nil {
+		return err
+	}
+
+	if printer == nil {
+		if err := printTable(t, nil, columns, noHeaders); err != nil {
+			return err
+		}
+		if err := t.Flush(); err != nil {
+			return err
+		}
+	}
+
+	headersPrinted := false
+	printTermination := func(p plugin.TerminatedPodInfo) error {
+
+		if printer == nil {
+			if err := printTable(t, plugin.TerminatedPods{p}, columns, true); err != nil {
+				return err
+			}
+			return t.Flush()
+		}
+
+		termination := p.ToTermination()
+		if err := printer.PrintObj(&termination, out); err != nil {
+			return err
+		}
+
+		// Printers with headers, such as custom-columns, only print them once.
+		if !headersPrinted {
+			headersPrinted = true
+			printer, err = outputFlags.toPrinter(true)
+		}
+
+		return err
+	}
+
+	opts.OnWatchError = func(err error) {
+		fmt.Fprintln(errOut, err)
+	}
+
+	handler := recordHistory(ctx, store, errOut, plugin.TerminationHandlerFuncs{TerminationFunc: printTermination})
+	return plugin.WatchWithHandler(ctx, client, opts, handler)
+}
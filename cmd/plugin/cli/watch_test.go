@@ -0,0 +1,99 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jdockerty/kubectl-oomd/internal/testutil"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// syncBuffer is a buffer which is safe to read whilst the watch is writing to it.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// waitForLines waits until the buffer contains the given number of lines.
+func waitForLines(t *testing.T, out *syncBuffer, lines int) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for strings.Count(out.String(), "\n") < lines {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %d lines, got:\n%s", lines, out.String())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestWatch(t *testing.T) {
+
+	tests := map[string]struct {
+		args []string
+		want []string
+	}{
+		"table": {
+			args: []string{"-n", "shop", "--watch"},
+			want: []string{"POD", "checkout-1", "checkout-2"},
+		},
+		"no headers": {
+			args: []string{"-n", "shop", "-w", "--no-headers"},
+			want: []string{"checkout-1", "checkout-2"},
+		},
+		"custom columns print headers once": {
+			args: []string{"-n", "shop", "-w", "-o", "custom-columns=POD:.pod"},
+			want: []string{"POD", "checkout-1", "checkout-2"},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+
+			client, watching := testutil.WatchedClient(testutil.Pod("shop", "checkout-1", 137, "OOMKilled"))
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			out := &syncBuffer{}
+			done := make(chan error)
+			go func() {
+				done <- runRootCmdContext(ctx, out, client, tc.args...)
+			}()
+
+			// The existing termination is printed first, then new ones as they happen.
+			waitForLines(t, out, len(tc.want)-1)
+			<-watching
+
+			_, err := client.CoreV1().Pods("shop").Create(ctx, testutil.Pod("shop", "checkout-2", 137, "OOMKilled"), metav1.CreateOptions{})
+			assert.Nil(t, err)
+
+			waitForLines(t, out, len(tc.want))
+			cancel()
+			assert.Nil(t, <-done)
+
+			lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+			assert.Equal(t, len(tc.want), len(lines))
+			for i, want := range tc.want {
+				assert.True(t, strings.HasPrefix(lines[i], want), "line %d: %q should start with %q", i, lines[i], want)
+			}
+		})
+	}
+}
@@ -0,0 +1,154 @@
+// Package testutil provides the fakes and fixtures shared by the tests of the
+// plugin and its commands, so that they can be run without a cluster.
+package testutil
+
+import (
+	"fmt"
+	"sync"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/meta/testrestmapper"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/metadata"
+	metadatafake "k8s.io/client-go/metadata/fake"
+	k8stesting "k8s.io/client-go/testing"
+	metricsclientset "k8s.io/metrics/pkg/client/clientset/versioned"
+	metricsfake "k8s.io/metrics/pkg/client/clientset/versioned/fake"
+)
+
+// ClientFactory is a plugin.ClientFactory which returns fake clients. The
+// RESTClientGetter, such as the kubeconfig flags, is still used for resolving
+// the namespace.
+type ClientFactory struct {
+	genericclioptions.RESTClientGetter
+
+	Client   kubernetes.Interface
+	Metrics  metricsclientset.Interface
+	Metadata metadata.Interface
+}
+
+// KubernetesClient returns the fake clientset, or an empty one when not set.
+func (f ClientFactory) KubernetesClient() (kubernetes.Interface, error) {
+	if f.Client == nil {
+		return fake.NewSimpleClientset(), nil
+	}
+	return f.Client, nil
+}
+
+// MetricsClient returns the fake metrics clientset, or an empty one when not set,
+// which behaves as though metrics-server has no metrics for the pods yet.
+func (f ClientFactory) MetricsClient() (metricsclientset.Interface, error) {
+	if f.Metrics == nil {
+		return metricsfake.NewSimpleClientset(), nil
+	}
+	return f.Metrics, nil
+}
+
+// MetadataClient returns the fake metadata client, or an empty one when not set.
+func (f ClientFactory) MetadataClient() (metadata.Interface, error) {
+	if f.Metadata == nil {
+		return MetadataClient(), nil
+	}
+	return f.Metadata, nil
+}
+
+// ToRESTMapper returns a mapper of the built-in resources, rather than using
+// discovery against the cluster of the kubeconfig.
+func (f ClientFactory) ToRESTMapper() (meta.RESTMapper, error) {
+	return testrestmapper.TestOnlyStaticRESTMapper(scheme.Scheme), nil
+}
+
+// MetadataClient returns a fake metadata client with the metadata of the objects,
+// which may be typed objects of the client-go scheme or unstructured.
+func MetadataClient(objects ...runtime.Object) *metadatafake.FakeMetadataClient {
+
+	s := metadatafake.NewTestScheme()
+	metav1.AddMetaToScheme(s)
+
+	partial := make([]runtime.Object, 0, len(objects))
+	for _, obj := range objects {
+		accessor, err := meta.Accessor(obj)
+		if err != nil {
+			panic(err)
+		}
+
+		gvk := obj.GetObjectKind().GroupVersionKind()
+		if gvk.Empty() {
+			gvks, _, err := scheme.Scheme.ObjectKinds(obj)
+			if err != nil {
+				panic(fmt.Sprintf("unknown kind of %T: %v", obj, err))
+			}
+			gvk = gvks[0]
+		}
+
+		m := &metav1.PartialObjectMetadata{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:       accessor.GetNamespace(),
+				Name:            accessor.GetName(),
+				Labels:          accessor.GetLabels(),
+				OwnerReferences: accessor.GetOwnerReferences(),
+			},
+		}
+		m.SetGroupVersionKind(gvk)
+		partial = append(partial, m)
+	}
+
+	return metadatafake.NewSimpleMetadataClient(s, partial...)
+}
+
+// Pod builds a pod with a single container named `app` and a 128Mi memory limit,
+// which was last terminated with the given exit code and reason.
+func Pod(namespace, name string, exitCode int32, reason string) *v1.Pod {
+	return &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name, UID: types.UID(namespace + "/" + name)},
+		Spec: v1.PodSpec{
+			Containers: []v1.Container{{
+				Name: "app",
+				Resources: v1.ResourceRequirements{
+					Limits: v1.ResourceList{v1.ResourceMemory: resource.MustParse("128Mi")},
+				},
+			}},
+		},
+		Status: v1.PodStatus{
+			ContainerStatuses: []v1.ContainerStatus{ContainerStatus("app", exitCode, reason)},
+		},
+	}
+}
+
+// ContainerStatus is the status of a container which was last terminated with the
+// given exit code and reason.
+func ContainerStatus(name string, exitCode int32, reason string) v1.ContainerStatus {
+	return v1.ContainerStatus{
+		Name: name,
+		LastTerminationState: v1.ContainerState{
+			Terminated: &v1.ContainerStateTerminated{ExitCode: exitCode, Reason: reason},
+		},
+	}
+}
+
+// WatchedClient returns a fake clientset with the given objects, along with a
+// channel which is closed once an informer has started watching pods. Changes made
+// before this would be missed, as the fake clientset does not replay them to new
+// watches.
+func WatchedClient(objects ...runtime.Object) (*fake.Clientset, <-chan struct{}) {
+
+	client := fake.NewSimpleClientset(objects...)
+
+	var once sync.Once
+	watching := make(chan struct{})
+	client.PrependWatchReactor("pods", func(k8stesting.Action) (bool, watch.Interface, error) {
+		once.Do(func() { close(watching) })
+		return false, nil, nil
+	})
+
+	return client, watching
+}
@@ -0,0 +1,85 @@
+package plugin
+
+import (
+	v1 "k8s.io/api/core/v1"
+)
+
+// TerminationCategory is a label describing why a container was terminated.
+type TerminationCategory string
+
+const (
+	// CategoryOOMKilled is a termination which the container runtime attributed
+	// to the kernel/cgroup OOM killer.
+	CategoryOOMKilled TerminationCategory = "OOMKilled"
+
+	// CategorySIGKILL is a SIGKILL which was not attributed to the OOM killer,
+	// such as a failed liveness probe or a manual `kill -9`.
+	CategorySIGKILL TerminationCategory = "SIGKILL"
+
+	// CategorySIGTERM is a termination caused by SIGTERM, usually a graceful shutdown.
+	CategorySIGTERM TerminationCategory = "SIGTERM"
+
+	// CategoryError is any other non-zero exit of the container.
+	CategoryError TerminationCategory = "Error"
+
+	// CategoryCompleted is a container which exited successfully.
+	CategoryCompleted TerminationCategory = "Completed"
+)
+
+const (
+	// The reason set by the container runtime when the OOM killer terminated the container.
+	oomKilledReason = "OOMKilled"
+
+	// Exit codes of a process killed by a signal are 128 + the signal number.
+	sigkillExitCode = 128 + sigkill
+	sigtermExitCode = 128 + sigterm
+
+	sigkill = 9
+	sigterm = 15
+)
+
+// TerminationClassifier decides which category a terminated container belongs
+// to and whether it should be reported as an out of memory kill.
+type TerminationClassifier interface {
+	Classify(terminated *v1.ContainerStateTerminated) (TerminationCategory, bool)
+}
+
+// DefaultClassifier reports containers which were OOMKilled, along with any other
+// SIGKILL unless Strict is set. A SIGKILL without the 'OOMKilled' reason is still
+// reported by default, as some container runtimes do not populate the reason.
+type DefaultClassifier struct {
+	// Strict only reports terminations attributed to the kernel/cgroup OOM killer.
+	Strict bool
+}
+
+// Classify implements TerminationClassifier.
+func (c DefaultClassifier) Classify(terminated *v1.ContainerStateTerminated) (TerminationCategory, bool) {
+	category := ClassifyTermination(terminated)
+
+	switch category {
+	case CategoryOOMKilled:
+		return category, true
+	case CategorySIGKILL:
+		return category, !c.Strict
+	default:
+		return category, false
+	}
+}
+
+// ClassifyTermination labels a terminated container using its reason, exit code
+// and signal together. The reason takes precedence, as an exit code of 137 alone
+// only tells us that the process received a SIGKILL, not who sent it.
+func ClassifyTermination(terminated *v1.ContainerStateTerminated) TerminationCategory {
+	switch {
+	case terminated.Reason == oomKilledReason:
+		return CategoryOOMKilled
+	case terminated.ExitCode == sigkillExitCode || terminated.Signal == sigkill:
+		return CategorySIGKILL
+	case terminated.ExitCode == sigtermExitCode || terminated.Signal == sigterm:
+		return CategorySIGTERM
+	case terminated.ExitCode == 0:
+		return CategoryCompleted
+	default:
+		return CategoryError
+	}
+}
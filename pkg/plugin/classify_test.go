@@ -0,0 +1,57 @@
+package plugin
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestClassifyTermination(t *testing.T) {
+
+	tests := map[string]struct {
+		terminated v1.ContainerStateTerminated
+		want       TerminationCategory
+	}{
+		"oomkilled reason":            {terminated: v1.ContainerStateTerminated{ExitCode: 137, Reason: "OOMKilled"}, want: CategoryOOMKilled},
+		"oomkilled reason takes over": {terminated: v1.ContainerStateTerminated{ExitCode: 1, Reason: "OOMKilled"}, want: CategoryOOMKilled},
+		"liveness probe sigkill":      {terminated: v1.ContainerStateTerminated{ExitCode: 137, Reason: "Error"}, want: CategorySIGKILL},
+		"sigkill by signal":           {terminated: v1.ContainerStateTerminated{Signal: 9}, want: CategorySIGKILL},
+		"graceful shutdown":           {terminated: v1.ContainerStateTerminated{ExitCode: 143, Reason: "Error"}, want: CategorySIGTERM},
+		"application error":           {terminated: v1.ContainerStateTerminated{ExitCode: 1, Reason: "Error"}, want: CategoryError},
+		"completed":                   {terminated: v1.ContainerStateTerminated{ExitCode: 0, Reason: "Completed"}, want: CategoryCompleted},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.want, ClassifyTermination(&tc.terminated))
+		})
+	}
+}
+
+func TestDefaultClassifier(t *testing.T) {
+
+	oomKilled := &v1.ContainerStateTerminated{ExitCode: 137, Reason: "OOMKilled"}
+	sigkilled := &v1.ContainerStateTerminated{ExitCode: 137, Reason: "Error"}
+	failed := &v1.ContainerStateTerminated{ExitCode: 1, Reason: "Error"}
+
+	tests := map[string]struct {
+		classifier DefaultClassifier
+		terminated *v1.ContainerStateTerminated
+		want       bool
+	}{
+		"reports oomkilled":             {classifier: DefaultClassifier{}, terminated: oomKilled, want: true},
+		"reports sigkill":               {classifier: DefaultClassifier{}, terminated: sigkilled, want: true},
+		"ignores errors":                {classifier: DefaultClassifier{}, terminated: failed, want: false},
+		"strict reports oomkilled":      {classifier: DefaultClassifier{Strict: true}, terminated: oomKilled, want: true},
+		"strict ignores plain sigkill":  {classifier: DefaultClassifier{Strict: true}, terminated: sigkilled, want: false},
+		"strict ignores regular errors": {classifier: DefaultClassifier{Strict: true}, terminated: failed, want: false},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, report := tc.classifier.Classify(tc.terminated)
+			assert.Equal(t, tc.want, report)
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package plugin
+
+import (
+	"fmt"
+
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/metadata"
+	metricsclientset "k8s.io/metrics/pkg/client/clientset/versioned"
+)
+
+// ClientFactory provides the clients which the plugin uses to talk to the cluster,
+// so that they can be replaced by fakes in tests. The RESTClientGetter is used for
+// resolving the kubeconfig namespace and resources given as arguments.
+type ClientFactory interface {
+	genericclioptions.RESTClientGetter
+
+	// KubernetesClient returns a client for the core Kubernetes APIs.
+	KubernetesClient() (kubernetes.Interface, error)
+
+	// MetricsClient returns a client for the metrics.k8s.io API, which is served
+	// by metrics-server when it is installed.
+	MetricsClient() (metricsclientset.Interface, error)
+
+	// MetadataClient returns a client for the metadata of any resource, including
+	// custom resources, which is used to follow ownerReferences to their top-level
+	// controller without retrieving the whole of each object.
+	MetadataClient() (metadata.Interface, error)
+}
+
+// configFlagsClientFactory builds clients from the kubeconfig flags which are
+// available to regular `kubectl` commands.
+type configFlagsClientFactory struct {
+	*genericclioptions.ConfigFlags
+}
+
+// NewClientFactory returns a ClientFactory which builds clients from the given flags.
+func NewClientFactory(configFlags *genericclioptions.ConfigFlags) ClientFactory {
+	return configFlagsClientFactory{ConfigFlags: configFlags}
+}
+
+// KubernetesClient implements ClientFactory.
+func (f configFlagsClientFactory) KubernetesClient() (kubernetes.Interface, error) {
+	clientset, _, err := getK8sClientAndConfig(f.ConfigFlags)
+	if err != nil {
+		return nil, err
+	}
+	return clientset, nil
+}
+
+// MetricsClient implements ClientFactory.
+func (f configFlagsClientFactory) MetricsClient() (metricsclientset.Interface, error) {
+
+	config, err := f.ToRESTConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read kubeconfig: %w", err)
+	}
+
+	return metricsclientset.NewForConfig(config)
+}
+
+// MetadataClient implements ClientFactory.
+func (f configFlagsClientFactory) MetadataClient() (metadata.Interface, error) {
+
+	config, err := f.ToRESTConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read kubeconfig: %w", err)
+	}
+
+	return metadata.NewForConfig(config)
+}
@@ -0,0 +1,374 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+// PatchType is the kind of patch which is generated to raise a memory limit.
+type PatchType string
+
+const (
+	// PatchTypeStrategic is a strategic merge patch, the containers are merged by name.
+	PatchTypeStrategic PatchType = "strategic"
+
+	// PatchTypeJSON is a JSON patch, the containers are addressed by their index
+	// after testing their name.
+	PatchTypeJSON PatchType = "json"
+)
+
+// FixOptions configures how the memory limits of the OOMKilled containers are raised.
+type FixOptions struct {
+	// Factor multiplies the current limit of each container, the recommended limit
+	// is used instead when 0.
+	Factor float64
+
+	// Recommend is the policy for the recommended limit, when there is no Factor.
+	Recommend RecommendOptions
+
+	// PatchType is the kind of patch which is generated, PatchTypeStrategic is used when empty.
+	PatchType PatchType
+}
+
+// FixPlan is the patches which raise the memory limits of the OOMKilled containers,
+// along with the workloads which could not be patched.
+type FixPlan struct {
+	Patches []WorkloadPatch
+	Skipped []SkippedFix
+}
+
+// WorkloadPatch is a patch for the pod template of a top-level workload, raising
+// the memory limit of each of its OOMKilled containers.
+type WorkloadPatch struct {
+	Namespace string
+	Kind      string
+	Name      string
+	Type      PatchType
+	Data      []byte
+	Changes   []LimitChange
+}
+
+// LimitChange is the memory limit of a single container being raised.
+type LimitChange struct {
+	Container string
+	From      resource.Quantity
+	To        resource.Quantity
+}
+
+// SkippedFix is a workload whose OOMKilled containers were not patched, such as
+// a pod without a controller.
+type SkippedFix struct {
+	Namespace string
+	Workload  string
+	Reason    string
+}
+
+// PlanFixes resolves each OOMKilled container to the top-level controller of its
+// pod, which is a Deployment, StatefulSet, DaemonSet or CronJob, and returns the
+// patches which raise their memory limits. The workloads are retrieved so that the
+// limit is raised from what is currently in the pod template, rather than from the
+// pods, which may be from an older rollout. Nothing is changed in the cluster.
+func PlanFixes(ctx context.Context, client kubernetes.Interface, owners *OwnerResolver, pods TerminatedPods, opts FixOptions) (FixPlan, error) {
+
+	if opts.PatchType == "" {
+		opts.PatchType = PatchTypeStrategic
+	}
+	if opts.PatchType != PatchTypeStrategic && opts.PatchType != PatchTypeJSON {
+		return FixPlan{}, fmt.Errorf("%s is not a supported patch type. One of: (%s, %s)", opts.PatchType, PatchTypeStrategic, PatchTypeJSON)
+	}
+
+	var plan FixPlan
+	groups := make(map[workloadKey]TerminatedPods)
+
+	for _, p := range pods {
+		if p.Category != CategoryOOMKilled {
+			continue
+		}
+
+		key, err := owners.resolve(ctx, p.Pod)
+		if err != nil {
+			return FixPlan{}, err
+		}
+
+		groups[key] = append(groups[key], p)
+	}
+
+	keys := make([]workloadKey, 0, len(groups))
+	for key := range groups {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.namespace != b.namespace {
+			return a.namespace < b.namespace
+		}
+		if a.kind != b.kind {
+			return a.kind < b.kind
+		}
+		return a.name < b.name
+	})
+
+	for _, key := range keys {
+
+		workload := key.String()
+
+		if key.kind == "Pod" {
+			plan.Skipped = append(plan.Skipped, SkippedFix{key.namespace, workload, "not owned by a Deployment, StatefulSet, DaemonSet or CronJob"})
+			continue
+		}
+
+		// Custom controllers, such as an Argo Rollout, have their own pod templates.
+		if !patchableKind(key.kind) {
+			plan.Skipped = append(plan.Skipped, SkippedFix{key.namespace, workload, "only Deployments, StatefulSets, DaemonSets and CronJobs can be patched"})
+			continue
+		}
+
+		template, path, err := getPodTemplate(ctx, client, key)
+		if apierrors.IsNotFound(err) {
+			plan.Skipped = append(plan.Skipped, SkippedFix{key.namespace, workload, "no longer exists"})
+			continue
+		}
+		if err != nil {
+			return FixPlan{}, fmt.Errorf("unable to retrieve %s in %s: %w", workload, key.namespace, err)
+		}
+
+		patch, skipped, err := planPatch(key, groups[key], template, path, opts)
+		if err != nil {
+			return FixPlan{}, fmt.Errorf("unable to build patch for %s in %s: %w", workload, key.namespace, err)
+		}
+		if patch == nil {
+			plan.Skipped = append(plan.Skipped, SkippedFix{key.namespace, workload, skipped})
+			continue
+		}
+
+		plan.Patches = append(plan.Patches, *patch)
+	}
+
+	return plan, nil
+}
+
+// patchableKind returns whether the pod template of the kind of workload can be patched.
+func patchableKind(kind string) bool {
+	switch kind {
+	case "Deployment", "StatefulSet", "DaemonSet", "CronJob":
+		return true
+	}
+	return false
+}
+
+// getPodTemplate retrieves the workload, returning its pod template and the path
+// to the template's spec, such as `/spec/template/spec`.
+func getPodTemplate(ctx context.Context, client kubernetes.Interface, key workloadKey) (v1.PodTemplateSpec, []string, error) {
+
+	templatePath := []string{"spec", "template", "spec"}
+
+	switch key.kind {
+	case "Deployment":
+		d, err := client.AppsV1().Deployments(key.namespace).Get(ctx, key.name, metav1.GetOptions{})
+		if err != nil {
+			return v1.PodTemplateSpec{}, nil, err
+		}
+		return d.Spec.Template, templatePath, nil
+
+	case "StatefulSet":
+		s, err := client.AppsV1().StatefulSets(key.namespace).Get(ctx, key.name, metav1.GetOptions{})
+		if err != nil {
+			return v1.PodTemplateSpec{}, nil, err
+		}
+		return s.Spec.Template, templatePath, nil
+
+	case "DaemonSet":
+		d, err := client.AppsV1().DaemonSets(key.namespace).Get(ctx, key.name, metav1.GetOptions{})
+		if err != nil {
+			return v1.PodTemplateSpec{}, nil, err
+		}
+		return d.Spec.Template, templatePath, nil
+
+	case "CronJob":
+		c, err := client.BatchV1().CronJobs(key.namespace).Get(ctx, key.name, metav1.GetOptions{})
+		if err != nil {
+			return v1.PodTemplateSpec{}, nil, err
+		}
+		return c.Spec.JobTemplate.Spec.Template, []string{"spec", "jobTemplate", "spec", "template", "spec"}, nil
+	}
+
+	return v1.PodTemplateSpec{}, nil, fmt.Errorf("%s is not a supported workload", key.kind)
+}
+
+// planPatch returns the patch which raises the limits of the OOMKilled containers
+// in the pod template, or the reason that it cannot be patched.
+func planPatch(key workloadKey, group TerminatedPods, template v1.PodTemplateSpec, path []string, opts FixOptions) (*WorkloadPatch, string, error) {
+
+	// The terminations are already grouped by their top-level workload, so each
+	// container is recommended from every one of its OOMs, rather than grouping
+	// them again such as by the Job of a CronJob.
+	recommended := make(map[string]resource.Quantity)
+	if opts.Factor == 0 {
+		containers := make(map[string]TerminatedPods)
+		for _, p := range group {
+			containers[p.ContainerName] = append(containers[p.ContainerName], p)
+		}
+
+		for name, terminations := range containers {
+			r := recommend(recommendationKey{key.namespace, key.String(), name}, terminations, opts.Recommend)
+			if r.Recommended.Limit != nil {
+				recommended[name] = resource.MustParse(r.Recommended.Limit.Quantity)
+			}
+		}
+	}
+
+	patch := &WorkloadPatch{Namespace: key.namespace, Kind: key.kind, Name: key.name, Type: opts.PatchType}
+
+	var reasons []string
+	var strategic []interface{}
+	var strategicInit []interface{}
+	var operations []interface{}
+	seen := make(map[string]bool)
+
+	for _, p := range group {
+
+		if seen[p.ContainerName] {
+			continue
+		}
+		seen[p.ContainerName] = true
+
+		field := "containers"
+		containers := template.Spec.Containers
+		switch p.ContainerType {
+		case ContainerTypeInit:
+			field, containers = "initContainers", template.Spec.InitContainers
+		case ContainerTypeEphemeral:
+			reasons = append(reasons, fmt.Sprintf("%s is an ephemeral container, which is not in the pod template", p.ContainerName))
+			continue
+		}
+
+		index := -1
+		for i, c := range containers {
+			if c.Name == p.ContainerName {
+				index = i
+			}
+		}
+		if index < 0 {
+			reasons = append(reasons, fmt.Sprintf("%s is no longer in the pod template", p.ContainerName))
+			continue
+		}
+
+		current := containers[index].Resources.Limits[v1.ResourceMemory]
+
+		// A new limit could be below the request of the template, which the API
+		// server rejects, so only existing limits are raised.
+		if current.IsZero() {
+			reasons = append(reasons, fmt.Sprintf("%s does not have a memory limit to raise", p.ContainerName))
+			continue
+		}
+
+		var limit resource.Quantity
+		if opts.Factor != 0 {
+			limit = scaleMemory(current, opts.Factor)
+		} else {
+			var ok bool
+			if limit, ok = recommended[p.ContainerName]; !ok {
+				reasons = append(reasons, fmt.Sprintf("there is nothing to base a recommendation for %s on", p.ContainerName))
+				continue
+			}
+		}
+
+		if current.Cmp(limit) >= 0 {
+			reasons = append(reasons, fmt.Sprintf("%s already has a memory limit of %s", p.ContainerName, current.String()))
+			continue
+		}
+
+		patch.Changes = append(patch.Changes, LimitChange{Container: p.ContainerName, From: current, To: limit})
+
+		container := map[string]interface{}{
+			"name":      p.ContainerName,
+			"resources": map[string]interface{}{"limits": map[string]interface{}{"memory": limit.String()}},
+		}
+		if field == "initContainers" {
+			strategicInit = append(strategicInit, container)
+		} else {
+			strategic = append(strategic, container)
+		}
+
+		// The containers are addressed by their index, so the patch is rejected if
+		// the container at the index has changed since the template was read.
+		containerPath := fmt.Sprintf("/%s/%s/%d", strings.Join(path, "/"), field, index)
+		operations = append(operations, map[string]interface{}{"op": "test", "path": containerPath + "/name", "value": p.ContainerName})
+
+		// Adding a member which already exists replaces it.
+		operations = append(operations, map[string]interface{}{"op": "add", "path": containerPath + "/resources/limits/memory", "value": limit.String()})
+	}
+
+	if len(patch.Changes) == 0 {
+		return nil, strings.Join(reasons, "; "), nil
+	}
+
+	var body interface{} = operations
+	if opts.PatchType == PatchTypeStrategic {
+		spec := make(map[string]interface{})
+		if len(strategic) > 0 {
+			spec["containers"] = strategic
+		}
+		if len(strategicInit) > 0 {
+			spec["initContainers"] = strategicInit
+		}
+
+		body = spec
+		for i := len(path) - 1; i >= 0; i-- {
+			body = map[string]interface{}{path[i]: body}
+		}
+	}
+
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, "", err
+	}
+	patch.Data = data
+
+	return patch, "", nil
+}
+
+// Apply sends the patch to the cluster. With dryRun, the patch is validated by
+// the API server without being persisted.
+func (p WorkloadPatch) Apply(ctx context.Context, client kubernetes.Interface, dryRun bool) error {
+
+	patchType := types.StrategicMergePatchType
+	if p.Type == PatchTypeJSON {
+		patchType = types.JSONPatchType
+	}
+
+	opts := metav1.PatchOptions{}
+	if dryRun {
+		opts.DryRun = []string{metav1.DryRunAll}
+	}
+
+	var err error
+	switch p.Kind {
+	case "Deployment":
+		_, err = client.AppsV1().Deployments(p.Namespace).Patch(ctx, p.Name, patchType, p.Data, opts)
+	case "StatefulSet":
+		_, err = client.AppsV1().StatefulSets(p.Namespace).Patch(ctx, p.Name, patchType, p.Data, opts)
+	case "DaemonSet":
+		_, err = client.AppsV1().DaemonSets(p.Namespace).Patch(ctx, p.Name, patchType, p.Data, opts)
+	case "CronJob":
+		_, err = client.BatchV1().CronJobs(p.Namespace).Patch(ctx, p.Name, patchType, p.Data, opts)
+	default:
+		return fmt.Errorf("%s is not a supported workload", p.Kind)
+	}
+
+	if err != nil {
+		return fmt.Errorf("unable to patch %s/%s in %s: %w", p.Kind, p.Name, p.Namespace, err)
+	}
+
+	return nil
+}
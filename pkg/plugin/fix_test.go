@@ -0,0 +1,236 @@
+package plugin
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jdockerty/kubectl-oomd/internal/testutil"
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// fixObjects returns the checkout Deployment, with a ReplicaSet and an OOMKilled
+// pod, and the report CronJob, with a Job and an OOMKilled pod. Both have the
+// `app` container with a 128Mi limit.
+func fixObjects() (*appsv1.Deployment, *batchv1.CronJob, TerminatedPods) {
+
+	controller := true
+	owned := func(apiVersion, kind, name string) []metav1.OwnerReference {
+		return []metav1.OwnerReference{{APIVersion: apiVersion, Kind: kind, Name: name, Controller: &controller}}
+	}
+
+	template := v1.PodTemplateSpec{Spec: testutil.Pod("shop", "template", 0, "").Spec}
+
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "checkout"},
+		Spec:       appsv1.DeploymentSpec{Template: template},
+	}
+	cronJob := &batchv1.CronJob{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "report"},
+		Spec:       batchv1.CronJobSpec{JobTemplate: batchv1.JobTemplateSpec{Spec: batchv1.JobSpec{Template: template}}},
+	}
+
+	checkout := testutil.Pod("shop", "checkout-5bcbcdf97-x2k8p", 137, "OOMKilled")
+	checkout.OwnerReferences = owned("apps/v1", "ReplicaSet", "checkout-5bcbcdf97")
+
+	report := testutil.Pod("shop", "report-27893-abcde", 137, "OOMKilled")
+	report.OwnerReferences = owned("batch/v1", "Job", "report-27893")
+
+	pods, _ := buildTerminatedPodsInfo([]v1.Pod{*checkout, *report}, DefaultClassifier{})
+	return deployment, cronJob, pods
+}
+
+func TestPlanFixes(t *testing.T) {
+
+	controller := true
+	deployment, cronJob, pods := fixObjects()
+
+	owners := []runtime.Object{
+		&appsv1.ReplicaSet{ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "checkout-5bcbcdf97", OwnerReferences: []metav1.OwnerReference{{APIVersion: "apps/v1", Kind: "Deployment", Name: "checkout", Controller: &controller}}}},
+		&batchv1.Job{ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "report-27893", OwnerReferences: []metav1.OwnerReference{{APIVersion: "batch/v1", Kind: "CronJob", Name: "report", Controller: &controller}}}},
+	}
+	client := fake.NewSimpleClientset(deployment, cronJob)
+
+	bare, _ := buildTerminatedPodsInfo([]v1.Pod{*testutil.Pod("shop", "debug", 137, "OOMKilled")}, DefaultClassifier{})
+
+	tests := map[string]struct {
+		opts        FixOptions
+		wantPatches map[string]string
+	}{
+		"recommended strategic": {
+			opts: FixOptions{},
+			wantPatches: map[string]string{
+				"CronJob/report":      `{"spec":{"jobTemplate":{"spec":{"template":{"spec":{"containers":[{"name":"app","resources":{"limits":{"memory":"160Mi"}}}]}}}}}}`,
+				"Deployment/checkout": `{"spec":{"template":{"spec":{"containers":[{"name":"app","resources":{"limits":{"memory":"160Mi"}}}]}}}}`,
+			},
+		},
+		"factor json": {
+			opts: FixOptions{Factor: 2, PatchType: PatchTypeJSON},
+			wantPatches: map[string]string{
+				"CronJob/report":      `[{"op":"test","path":"/spec/jobTemplate/spec/template/spec/containers/0/name","value":"app"},{"op":"add","path":"/spec/jobTemplate/spec/template/spec/containers/0/resources/limits/memory","value":"256Mi"}]`,
+				"Deployment/checkout": `[{"op":"test","path":"/spec/template/spec/containers/0/name","value":"app"},{"op":"add","path":"/spec/template/spec/containers/0/resources/limits/memory","value":"256Mi"}]`,
+			},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+
+			plan, err := PlanFixes(context.Background(), client, testOwnerResolver(owners...), append(pods, bare...), tc.opts)
+			assert.Nil(t, err)
+
+			got := make(map[string]string)
+			for _, p := range plan.Patches {
+				got[p.Kind+"/"+p.Name] = string(p.Data)
+				assert.Equal(t, "128Mi", p.Changes[0].From.String())
+			}
+			assert.Equal(t, tc.wantPatches, got)
+
+			assert.Equal(t, []SkippedFix{{Namespace: "shop", Workload: "Pod/debug", Reason: "not owned by a Deployment, StatefulSet, DaemonSet or CronJob"}}, plan.Skipped)
+		})
+	}
+}
+
+func TestPlanFixesDeletedReplicaSet(t *testing.T) {
+
+	deployment, _, pods := fixObjects()
+
+	// The ReplicaSet of an old rollout has been deleted, the Deployment is still
+	// found from its name and the pod template hash.
+	pods[0].Pod.Labels = map[string]string{appsv1.DefaultDeploymentUniqueLabelKey: "5bcbcdf97"}
+
+	plan, err := PlanFixes(context.Background(), fake.NewSimpleClientset(deployment), testOwnerResolver(), pods[:1], FixOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(plan.Patches))
+	assert.Equal(t, "Deployment", plan.Patches[0].Kind)
+}
+
+func TestPlanFixesAlreadyRaised(t *testing.T) {
+
+	deployment, _, pods := fixObjects()
+	deployment.Spec.Template.Spec.Containers[0].Resources.Limits[v1.ResourceMemory] = resource.MustParse("1Gi")
+	pods[0].Pod.Labels = map[string]string{appsv1.DefaultDeploymentUniqueLabelKey: "5bcbcdf97"}
+
+	plan, err := PlanFixes(context.Background(), fake.NewSimpleClientset(deployment), testOwnerResolver(), pods[:1], FixOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(plan.Patches))
+	assert.Equal(t, []SkippedFix{{Namespace: "shop", Workload: "Deployment/checkout", Reason: "app already has a memory limit of 1Gi"}}, plan.Skipped)
+}
+
+func TestPlanFixesWithoutLimit(t *testing.T) {
+
+	deployment, _, pods := fixObjects()
+	pods[0].Pod.Labels = map[string]string{appsv1.DefaultDeploymentUniqueLabelKey: "5bcbcdf97"}
+
+	// A new limit may be below the request of the template, which is rejected by
+	// the API server, so a container without a limit is skipped in either mode.
+	deployment.Spec.Template.Spec.Containers[0].Resources = v1.ResourceRequirements{
+		Requests: v1.ResourceList{v1.ResourceMemory: resource.MustParse("1Gi")},
+	}
+
+	for name, opts := range map[string]FixOptions{"recommended": {}, "factor": {Factor: 2}} {
+		t.Run(name, func(t *testing.T) {
+			plan, err := PlanFixes(context.Background(), fake.NewSimpleClientset(deployment), testOwnerResolver(), pods[:1], opts)
+			assert.Nil(t, err)
+			assert.Equal(t, 0, len(plan.Patches))
+			assert.Equal(t, []SkippedFix{{Namespace: "shop", Workload: "Deployment/checkout", Reason: "app does not have a memory limit to raise"}}, plan.Skipped)
+		})
+	}
+}
+
+func TestWorkloadPatchApply(t *testing.T) {
+
+	for _, patchType := range []PatchType{PatchTypeStrategic, PatchTypeJSON} {
+		t.Run(string(patchType), func(t *testing.T) {
+
+			deployment, _, pods := fixObjects()
+			pods[0].Pod.Labels = map[string]string{appsv1.DefaultDeploymentUniqueLabelKey: "5bcbcdf97"}
+			client := fake.NewSimpleClientset(deployment)
+
+			plan, err := PlanFixes(context.Background(), client, testOwnerResolver(), pods[:1], FixOptions{PatchType: patchType})
+			assert.Nil(t, err)
+			assert.Equal(t, 1, len(plan.Patches))
+			assert.Nil(t, plan.Patches[0].Apply(context.Background(), client, false))
+
+			patched, err := client.AppsV1().Deployments("shop").Get(context.Background(), "checkout", metav1.GetOptions{})
+			assert.Nil(t, err)
+
+			limit := patched.Spec.Template.Spec.Containers[0].Resources.Limits[v1.ResourceMemory]
+			assert.Equal(t, "160Mi", limit.String())
+		})
+	}
+}
+
+func TestPlanFixesInvalidPatchType(t *testing.T) {
+	_, err := PlanFixes(context.Background(), fake.NewSimpleClientset(), testOwnerResolver(), nil, FixOptions{PatchType: "merge"})
+	assert.NotNil(t, err)
+}
+
+func TestPlanFixesCustomController(t *testing.T) {
+
+	_, _, pods := fixObjects()
+
+	owners := testOwnerResolver(
+		&appsv1.ReplicaSet{ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "checkout-5bcbcdf97", OwnerReferences: []metav1.OwnerReference{*controllerOf(rolloutKind, "checkout")}}},
+		customObject(rolloutKind, "checkout", nil),
+	)
+
+	plan, err := PlanFixes(context.Background(), fake.NewSimpleClientset(), owners, pods[:1], FixOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(plan.Patches))
+	assert.Equal(t, []SkippedFix{{Namespace: "shop", Workload: "Rollout/checkout", Reason: "only Deployments, StatefulSets, DaemonSets and CronJobs can be patched"}}, plan.Skipped)
+}
+
+func TestPlanFixesCronJobHeadroom(t *testing.T) {
+
+	_, cronJob, _ := fixObjects()
+
+	// Every run of the CronJob is a different Job, the OOMs of all of them are
+	// counted towards the headroom of the CronJob.
+	var objects []runtime.Object
+	var oomed []v1.Pod
+	for _, job := range []string{"report-27891", "report-27892", "report-27893"} {
+		objects = append(objects, &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: job, OwnerReferences: []metav1.OwnerReference{*controllerOf(batchv1.SchemeGroupVersion.WithKind("CronJob"), "report")}}})
+
+		pod := testutil.Pod("shop", job+"-abcde", 137, "OOMKilled")
+		pod.OwnerReferences = []metav1.OwnerReference{*controllerOf(batchv1.SchemeGroupVersion.WithKind("Job"), job)}
+		pod.Status.ContainerStatuses[0].LastTerminationState.Terminated.FinishedAt = metav1.Now()
+		oomed = append(oomed, *pod)
+	}
+	pods, _ := buildTerminatedPodsInfo(oomed, DefaultClassifier{})
+
+	plan, err := PlanFixes(context.Background(), fake.NewSimpleClientset(cronJob), testOwnerResolver(objects...), pods, FixOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(plan.Patches))
+	assert.Equal(t, "224Mi", plan.Patches[0].Changes[0].To.String())
+}
+
+func TestWorkloadPatchApplyChangedTemplate(t *testing.T) {
+
+	deployment, _, pods := fixObjects()
+	pods[0].Pod.Labels = map[string]string{appsv1.DefaultDeploymentUniqueLabelKey: "5bcbcdf97"}
+	client := fake.NewSimpleClientset(deployment)
+
+	plan, err := PlanFixes(context.Background(), client, testOwnerResolver(), pods[:1], FixOptions{PatchType: PatchTypeJSON})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(plan.Patches))
+
+	// A sidecar is added before the container after the patch was planned, the
+	// patch no longer applies to the same container.
+	changed := deployment.DeepCopy()
+	changed.Spec.Template.Spec.Containers = append([]v1.Container{{Name: "sidecar"}}, changed.Spec.Template.Spec.Containers...)
+	_, err = client.AppsV1().Deployments("shop").Update(context.Background(), changed, metav1.UpdateOptions{})
+	assert.Nil(t, err)
+
+	assert.NotNil(t, plan.Patches[0].Apply(context.Background(), client, false))
+
+	patched, err := client.AppsV1().Deployments("shop").Get(context.Background(), "checkout", metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(patched.Spec.Template.Spec.Containers[0].Resources.Limits))
+}
@@ -0,0 +1,149 @@
+package plugin
+
+import (
+	"context"
+	"sort"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+const (
+	// WorkloadGroupKind is the kind of the terminations of a single container in a workload.
+	WorkloadGroupKind = "WorkloadGroup"
+
+	// WorkloadGroupListKind is the kind of a list of workload groups.
+	WorkloadGroupListKind = "WorkloadGroupList"
+)
+
+// WorkloadGroupList is a list of workload groups, used for machine readable
+// output such as JSON and YAML.
+type WorkloadGroupList struct {
+	metav1.TypeMeta `json:",inline"`
+
+	Items []WorkloadGroup `json:"items"`
+}
+
+// WorkloadGroup is the terminations of a single container across the replicas
+// of a workload, collapsed into one.
+type WorkloadGroup struct {
+	metav1.TypeMeta `json:",inline"`
+
+	Namespace string `json:"namespace"`
+
+	// Workload is the top-level controller of the pods, or the pod itself when it
+	// does not have one.
+	Workload  string `json:"workload"`
+	Container string `json:"container"`
+
+	// OOMs is the number of terminations of the container in the workload.
+	OOMs int `json:"ooms"`
+
+	// Replicas is the number of pods of the workload with a terminated container.
+	Replicas int `json:"replicas"`
+
+	// Last is the most recent termination, this has the limit it was killed at.
+	Last Termination `json:"last"`
+
+	// last is the terminated pod of Last, which the groups are sorted by.
+	last TerminatedPodInfo
+}
+
+// groupKey groups the terminations of the same container in a top-level workload.
+type groupKey struct {
+	workload  workloadKey
+	container string
+}
+
+// GroupByOwner walks the ownerReferences of each pod to its top-level controller,
+// such as the Deployment of a ReplicaSet or the CronJob of a Job, and collapses the
+// terminations of its replicas into a single group for each container.
+func GroupByOwner(ctx context.Context, owners *OwnerResolver, pods TerminatedPods) (*WorkloadGroupList, error) {
+
+	groups := make(map[groupKey]TerminatedPods)
+
+	for _, p := range pods {
+		workload, err := owners.resolve(ctx, p.Pod)
+		if err != nil {
+			return nil, err
+		}
+
+		key := groupKey{workload, p.ContainerName}
+		groups[key] = append(groups[key], p)
+	}
+
+	items := make([]WorkloadGroup, 0, len(groups))
+	for key, group := range groups {
+
+		var latest TerminatedPodInfo
+		replicas := make(map[string]bool)
+
+		for _, p := range group {
+			replicas[p.Pod.Name] = true
+			if !p.terminatedTime.Before(latest.terminatedTime) {
+				latest = p
+			}
+		}
+
+		items = append(items, WorkloadGroup{
+			TypeMeta:  metav1.TypeMeta{APIVersion: APIVersion, Kind: WorkloadGroupKind},
+			Namespace: key.workload.namespace,
+			Workload:  key.workload.String(),
+			Container: key.container,
+			OOMs:      len(group),
+			Replicas:  len(replicas),
+			Last:      latest.ToTermination(),
+			last:      latest,
+		})
+	}
+
+	sort.Slice(items, func(i, j int) bool {
+		a, b := items[i], items[j]
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		if a.Workload != b.Workload {
+			return a.Workload < b.Workload
+		}
+		return a.Container < b.Container
+	})
+
+	return &WorkloadGroupList{
+		TypeMeta: metav1.TypeMeta{APIVersion: APIVersion, Kind: WorkloadGroupListKind},
+		Items:    items,
+	}, nil
+}
+
+// SortBy sorts the groups by the fields of their most recent termination, in the
+// same way as TerminatedPods.SortBy.
+func (l *WorkloadGroupList) SortBy(fields []SortField, reverse bool) {
+	sort.SliceStable(l.Items, func(i, j int) bool {
+		return lessBy(fields, reverse, l.Items[i].last, l.Items[j].last)
+	})
+}
+
+// DeepCopyInto copies the receiver into out, both must be non-nil.
+func (in *WorkloadGroup) DeepCopyInto(out *WorkloadGroup) {
+	*out = *in
+	in.Last.DeepCopyInto(&out.Last)
+}
+
+// DeepCopyObject implements runtime.Object.
+func (in *WorkloadGroup) DeepCopyObject() runtime.Object {
+	out := new(WorkloadGroup)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject implements runtime.Object.
+func (in *WorkloadGroupList) DeepCopyObject() runtime.Object {
+	out := new(WorkloadGroupList)
+	out.TypeMeta = in.TypeMeta
+	if in.Items != nil {
+		out.Items = make([]WorkloadGroup, len(in.Items))
+		for i := range in.Items {
+			in.Items[i].DeepCopyInto(&out.Items[i])
+		}
+	}
+	return out
+}
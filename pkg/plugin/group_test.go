@@ -0,0 +1,70 @@
+package plugin
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jdockerty/kubectl-oomd/internal/testutil"
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestGroupByOwner(t *testing.T) {
+
+	controller := true
+	owned := func(apiVersion, kind, name string) []metav1.OwnerReference {
+		return []metav1.OwnerReference{{APIVersion: apiVersion, Kind: kind, Name: name, Controller: &controller}}
+	}
+
+	var objects []v1.Pod
+	for i, name := range []string{"checkout-5bcbcdf97-a", "checkout-5bcbcdf97-b", "checkout-7d9c6b5f4-c"} {
+		pod := testutil.Pod("shop", name, 137, "OOMKilled")
+		pod.OwnerReferences = owned("apps/v1", "ReplicaSet", name[:len(name)-2])
+		pod.Status.ContainerStatuses[0].LastTerminationState.Terminated.FinishedAt = metav1.NewTime(time.Date(2023, 1, 2, i, 0, 0, 0, time.UTC))
+		objects = append(objects, *pod)
+	}
+
+	// The same pod is terminated again, which is not another replica.
+	again := objects[1].DeepCopy()
+	again.Status.ContainerStatuses[0].LastTerminationState.Terminated.FinishedAt = metav1.NewTime(time.Date(2023, 1, 2, 5, 0, 0, 0, time.UTC))
+	again.Spec.Containers[0].Resources.Limits[v1.ResourceMemory] = resource.MustParse("256Mi")
+	objects = append(objects, *again)
+
+	report := testutil.Pod("shop", "report-27893-abcde", 137, "OOMKilled")
+	report.OwnerReferences = owned("batch/v1", "Job", "report-27893")
+	objects = append(objects, *report, *testutil.Pod("shop", "debug", 137, "OOMKilled"))
+
+	pods, _ := buildTerminatedPodsInfo(objects, DefaultClassifier{})
+
+	owners := testOwnerResolver(
+		&appsv1.ReplicaSet{ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "checkout-5bcbcdf97", OwnerReferences: owned("apps/v1", "Deployment", "checkout")}},
+		&appsv1.ReplicaSet{ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "checkout-7d9c6b5f4", OwnerReferences: owned("apps/v1", "Deployment", "checkout")}},
+		&batchv1.Job{ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "report-27893", OwnerReferences: owned("batch/v1", "CronJob", "report")}},
+	)
+
+	list, err := GroupByOwner(context.Background(), owners, pods)
+	assert.Nil(t, err)
+	assert.Equal(t, WorkloadGroupListKind, list.Kind)
+
+	type group struct {
+		workload       string
+		ooms, replicas int
+		lastPod, limit string
+	}
+
+	var got []group
+	for _, g := range list.Items {
+		got = append(got, group{g.Workload, g.OOMs, g.Replicas, g.Last.Pod, g.Last.Memory.Limit.Quantity})
+	}
+
+	assert.Equal(t, []group{
+		{"CronJob/report", 1, 1, "report-27893-abcde", "128Mi"},
+		{"Deployment/checkout", 4, 3, "checkout-5bcbcdf97-b", "256Mi"},
+		{"Pod/debug", 1, 1, "debug", "128Mi"},
+	}, got)
+}
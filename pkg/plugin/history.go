@@ -0,0 +1,478 @@
+package plugin
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+)
+
+// HistoryStore records terminations, so that they are still available after the
+// pod has been deleted or the container has been terminated again.
+type HistoryStore interface {
+	// Record adds the terminations to the history, those which have already
+	// been recorded are ignored.
+	Record(ctx context.Context, terminations []Termination) error
+
+	// Query returns the recorded terminations which match the query, ordered by
+	// their termination time.
+	Query(ctx context.Context, query HistoryQuery) ([]Termination, error)
+}
+
+// HistoryQuery restricts the terminations returned from the history, empty
+// fields match every termination.
+type HistoryQuery struct {
+	// Namespace of the pods, metav1.NamespaceAll matches every namespace.
+	Namespace string
+
+	// Owner is the workload which the pods belong to, such as `Deployment/checkout`.
+	// The kind is matched case-insensitively.
+	Owner string
+
+	// Since and Until are the inclusive time range the containers were terminated in.
+	Since time.Time
+	Until time.Time
+}
+
+// matches returns whether the termination matches the query.
+func (q HistoryQuery) matches(t Termination) bool {
+
+	if q.Namespace != metav1.NamespaceAll && t.Namespace != q.Namespace {
+		return false
+	}
+
+	if q.Owner != "" && !sameOwner(q.Owner, t.Owner) {
+		return false
+	}
+
+	if !q.Since.IsZero() && t.TerminatedTime.Time.Before(q.Since) {
+		return false
+	}
+
+	if !q.Until.IsZero() && t.TerminatedTime.Time.After(q.Until) {
+		return false
+	}
+
+	return true
+}
+
+// sameOwner compares two owners given as `Kind/Name`, where the kind is case-insensitive.
+func sameOwner(a, b string) bool {
+
+	aKind, aName, _ := strings.Cut(a, "/")
+	bKind, bName, _ := strings.Cut(b, "/")
+
+	return strings.EqualFold(aKind, bKind) && aName == bName
+}
+
+// OpenHistoryStore opens the history store from its specification, which is one of:
+//
+//	file:PATH                     a JSON lines file on the local machine
+//	configmap:[NAMESPACE/]NAME    a ConfigMap in the cluster, using the namespace when omitted
+//
+// The client is only retrieved for stores which are in the cluster.
+func OpenHistoryStore(spec string, client func() (kubernetes.Interface, error), namespace string) (HistoryStore, error) {
+
+	backend, location, _ := strings.Cut(spec, ":")
+	if location == "" {
+		return nil, fmt.Errorf("invalid history store %q, must be file:PATH or configmap:[NAMESPACE/]NAME", spec)
+	}
+
+	switch backend {
+	case "file":
+		if strings.HasPrefix(location, "~/") {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return nil, err
+			}
+			location = filepath.Join(home, location[2:])
+		}
+		return &FileHistory{Path: location}, nil
+
+	case "configmap":
+		if ns, name, ok := strings.Cut(location, "/"); ok {
+			namespace, location = ns, name
+		}
+
+		c, err := client()
+		if err != nil {
+			return nil, err
+		}
+		return &ConfigMapHistory{Client: c, Namespace: namespace, Name: location}, nil
+
+	default:
+		return nil, fmt.Errorf("invalid history store %q, %s is not a supported backend. One of: (file, configmap)", spec, backend)
+	}
+}
+
+// FileHistory stores the history in a local file, with a JSON encoded termination
+// on each line. New terminations are appended, so the file is never rewritten.
+//
+// The file is locked whilst it is appended to, so that it can be shared by more
+// than one process, such as a watch running alongside a regular run.
+type FileHistory struct {
+	Path string
+
+	mu       sync.Mutex
+	recorded map[string]bool // The IDs of the terminations in the file.
+	offset   int64           // How much of the file has been read into recorded.
+}
+
+// Record implements HistoryStore. The IDs of the recorded terminations are kept,
+// so that only the lines appended by others since the last call are read.
+func (f *FileHistory) Record(ctx context.Context, terminations []Termination) error {
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(f.Path), 0o755); err != nil {
+		return fmt.Errorf("unable to create history directory: %w", err)
+	}
+
+	file, err := os.OpenFile(f.Path, os.O_APPEND|os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return fmt.Errorf("unable to open history file: %w", err)
+	}
+	defer file.Close()
+
+	if err := lockFile(file); err != nil {
+		return fmt.Errorf("unable to lock history file: %w", err)
+	}
+	defer unlockFile(file)
+
+	if err := f.readRecorded(file); err != nil {
+		return err
+	}
+
+	added := unrecorded(f.recorded, terminations)
+	if len(added) == 0 {
+		return nil
+	}
+
+	var b bytes.Buffer
+	if err := encodeHistory(&b, added); err != nil {
+		return err
+	}
+
+	n, err := file.Write(b.Bytes())
+	f.offset += int64(n)
+	if err != nil {
+		// The IDs of the terminations which were not written are already recorded,
+		// so the file is read again next time.
+		f.recorded = nil
+		return fmt.Errorf("unable to write history file: %w", err)
+	}
+
+	return nil
+}
+
+// readRecorded adds the IDs of the terminations which have been appended to the
+// file since it was last read, the file must be locked.
+func (f *FileHistory) readRecorded(file *os.File) error {
+
+	info, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("unable to read history file: %w", err)
+	}
+
+	// The file has been replaced or truncated, so is read again from the start.
+	if f.recorded == nil || info.Size() < f.offset {
+		f.recorded = make(map[string]bool)
+		f.offset = 0
+	}
+
+	b := make([]byte, info.Size()-f.offset)
+	if _, err := file.ReadAt(b, f.offset); err != nil && err != io.EOF {
+		return fmt.Errorf("unable to read history file: %w", err)
+	}
+
+	terminations, err := decodeHistory(b)
+	if err != nil {
+		f.recorded = nil
+		return fmt.Errorf("unable to read history file %s: %w", f.Path, err)
+	}
+
+	for _, t := range terminations {
+		f.recorded[t.ID()] = true
+	}
+	f.offset = info.Size()
+
+	return nil
+}
+
+// Query implements HistoryStore.
+func (f *FileHistory) Query(ctx context.Context, query HistoryQuery) ([]Termination, error) {
+
+	terminations, err := f.read()
+	if err != nil {
+		return nil, err
+	}
+
+	return filterHistory(terminations, query), nil
+}
+
+// read returns every termination in the file, which may not exist yet.
+func (f *FileHistory) read() ([]Termination, error) {
+
+	b, err := os.ReadFile(f.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read history file: %w", err)
+	}
+
+	terminations, err := decodeHistory(b)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read history file %s: %w", f.Path, err)
+	}
+
+	return terminations, nil
+}
+
+// DefaultConfigMapHistoryLimit is the number of terminations kept in a ConfigMap.
+const DefaultConfigMapHistoryLimit = 1000
+
+// DefaultConfigMapHistoryBytes is the encoded size of the terminations kept in a
+// ConfigMap, which leaves room within the 1MiB size limit of objects in the cluster
+// for the rest of the ConfigMap. Terminations with a long message, such as the
+// logs of a container with `FallbackToLogsOnError`, reach this before the limit.
+const DefaultConfigMapHistoryBytes = 900 * 1024
+
+// configMapHistoryKey is the key in the ConfigMap's data containing the history.
+const configMapHistoryKey = "history.jsonl"
+
+// ConfigMapHistory stores the history in a ConfigMap in the cluster, so that it
+// is shared by everyone, in the same JSON lines format as FileHistory. Only the
+// most recent terminations are kept, as objects in the cluster are limited in size.
+type ConfigMapHistory struct {
+	Client    kubernetes.Interface
+	Namespace string
+	Name      string
+
+	// Limit is the number of terminations which are kept, DefaultConfigMapHistoryLimit
+	// is used when 0.
+	Limit int
+
+	// MaxBytes is the encoded size of the terminations which are kept,
+	// DefaultConfigMapHistoryBytes is used when 0.
+	MaxBytes int
+}
+
+// Record implements HistoryStore, the ConfigMap is created when it does not exist.
+func (c *ConfigMapHistory) Record(ctx context.Context, terminations []Termination) error {
+
+	limit := c.Limit
+	if limit == 0 {
+		limit = DefaultConfigMapHistoryLimit
+	}
+
+	maxBytes := c.MaxBytes
+	if maxBytes == 0 {
+		maxBytes = DefaultConfigMapHistoryBytes
+	}
+
+	configMaps := c.Client.CoreV1().ConfigMaps(c.Namespace)
+
+	// The ConfigMap may be updated by others at the same time, such as a watch
+	// running alongside a regular run, so the update is retried on conflicts.
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+
+		cm, err := configMaps.Get(ctx, c.Name, metav1.GetOptions{})
+		exists := err == nil
+		if apierrors.IsNotFound(err) {
+			cm = &v1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: c.Namespace, Name: c.Name}}
+		} else if err != nil {
+			return err
+		}
+
+		existing, err := decodeHistory([]byte(cm.Data[configMapHistoryKey]))
+		if err != nil {
+			return fmt.Errorf("unable to read history from ConfigMap %s/%s: %w", c.Namespace, c.Name, err)
+		}
+
+		added := unrecorded(recordedIDs(existing), terminations)
+		if len(added) == 0 {
+			return nil
+		}
+
+		// The oldest terminations are dropped first.
+		all := append(existing, added...)
+		sortHistory(all)
+		if len(all) > limit {
+			all = all[len(all)-limit:]
+		}
+
+		b, err := encodeHistoryWithin(all, maxBytes)
+		if err != nil {
+			return err
+		}
+
+		if cm.Data == nil {
+			cm.Data = make(map[string]string)
+		}
+		cm.Data[configMapHistoryKey] = b.String()
+
+		if !exists {
+			_, err = configMaps.Create(ctx, cm, metav1.CreateOptions{})
+			if apierrors.IsAlreadyExists(err) {
+				return apierrors.NewConflict(v1.Resource("configmaps"), c.Name, err)
+			}
+			return err
+		}
+
+		_, err = configMaps.Update(ctx, cm, metav1.UpdateOptions{})
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("unable to record history in ConfigMap %s/%s: %w", c.Namespace, c.Name, err)
+	}
+
+	return nil
+}
+
+// Query implements HistoryStore.
+func (c *ConfigMapHistory) Query(ctx context.Context, query HistoryQuery) ([]Termination, error) {
+
+	cm, err := c.Client.CoreV1().ConfigMaps(c.Namespace).Get(ctx, c.Name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read history from ConfigMap %s/%s: %w", c.Namespace, c.Name, err)
+	}
+
+	terminations, err := decodeHistory([]byte(cm.Data[configMapHistoryKey]))
+	if err != nil {
+		return nil, fmt.Errorf("unable to read history from ConfigMap %s/%s: %w", c.Namespace, c.Name, err)
+	}
+
+	return filterHistory(terminations, query), nil
+}
+
+// recordedIDs returns the IDs of the terminations in the existing history.
+func recordedIDs(existing []Termination) map[string]bool {
+
+	recorded := make(map[string]bool, len(existing))
+	for _, t := range existing {
+		recorded[t.ID()] = true
+	}
+
+	return recorded
+}
+
+// unrecorded returns the terminations which have not been recorded, including those
+// which appear more than once in the terminations themselves. The IDs of those which
+// are returned are added to recorded.
+func unrecorded(recorded map[string]bool, terminations []Termination) []Termination {
+
+	var added []Termination
+	for _, t := range terminations {
+		if recorded[t.ID()] {
+			continue
+		}
+		recorded[t.ID()] = true
+		added = append(added, t)
+	}
+
+	return added
+}
+
+// filterHistory returns the terminations matching the query, sorted by their
+// termination time.
+func filterHistory(terminations []Termination, query HistoryQuery) []Termination {
+
+	var matched []Termination
+	for _, t := range terminations {
+		if query.matches(t) {
+			matched = append(matched, t)
+		}
+	}
+
+	sortHistory(matched)
+	return matched
+}
+
+// sortHistory sorts the terminations by their termination time, in ascending order.
+func sortHistory(terminations []Termination) {
+	sort.SliceStable(terminations, func(i, j int) bool {
+		return terminations[i].TerminatedTime.Before(&terminations[j].TerminatedTime)
+	})
+}
+
+// encodeHistory writes each termination as a line of JSON.
+func encodeHistory(w io.Writer, terminations []Termination) error {
+
+	encoder := json.NewEncoder(w)
+	for _, t := range terminations {
+		if err := encoder.Encode(t); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// encodeHistoryWithin encodes the most recent of the sorted terminations which fit
+// within the size, dropping the oldest first.
+func encodeHistoryWithin(terminations []Termination, maxBytes int) (bytes.Buffer, error) {
+
+	lines := make([][]byte, len(terminations))
+	size, first := 0, len(terminations)
+
+	for i := len(terminations) - 1; i >= 0; i-- {
+		var line bytes.Buffer
+		if err := encodeHistory(&line, terminations[i:i+1]); err != nil {
+			return bytes.Buffer{}, err
+		}
+		if size+line.Len() > maxBytes {
+			break
+		}
+		lines[i], size, first = line.Bytes(), size+line.Len(), i
+	}
+
+	var b bytes.Buffer
+	for _, line := range lines[first:] {
+		b.Write(line)
+	}
+
+	return b, nil
+}
+
+// decodeHistory reads the terminations written by encodeHistory, blank lines are ignored.
+func decodeHistory(b []byte) ([]Termination, error) {
+
+	var terminations []Termination
+
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+
+		var t Termination
+		if err := json.Unmarshal(scanner.Bytes(), &t); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		terminations = append(terminations, t)
+	}
+
+	return terminations, scanner.Err()
+}
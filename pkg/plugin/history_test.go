@@ -0,0 +1,250 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// historyTermination returns a termination of the `app` container, which happened
+// the given number of hours after midnight on the 2nd of January 2023.
+func historyTermination(namespace, pod, owner string, hour int) Termination {
+	return Termination{
+		TypeMeta:       metav1.TypeMeta{APIVersion: APIVersion, Kind: TerminationKind},
+		Namespace:      namespace,
+		Pod:            pod,
+		PodUID:         types.UID(namespace + "/" + pod),
+		Owner:          owner,
+		Container:      "app",
+		Category:       CategoryOOMKilled,
+		TerminatedTime: metav1.NewTime(time.Date(2023, 1, 2, hour, 0, 0, 0, time.UTC)),
+	}
+}
+
+func TestHistoryStores(t *testing.T) {
+
+	stores := map[string]func(t *testing.T) HistoryStore{
+		"file": func(t *testing.T) HistoryStore {
+			return &FileHistory{Path: filepath.Join(t.TempDir(), "oomd", "history.jsonl")}
+		},
+		"configmap": func(t *testing.T) HistoryStore {
+			return &ConfigMapHistory{Client: fake.NewSimpleClientset(), Namespace: "oomd", Name: "oomd-history"}
+		},
+	}
+
+	checkout1 := historyTermination("shop", "checkout-1", "Deployment/checkout", 3)
+	checkout2 := historyTermination("shop", "checkout-2", "Deployment/checkout", 1)
+	payments := historyTermination("shop", "payments-1", "Deployment/payments", 2)
+	kafka := historyTermination("kafka", "kafka-0", "StatefulSet/kafka", 4)
+
+	for name, newStore := range stores {
+		t.Run(name, func(t *testing.T) {
+
+			ctx := context.Background()
+			store := newStore(t)
+
+			// Nothing has been recorded yet.
+			got, err := store.Query(ctx, HistoryQuery{})
+			assert.Nil(t, err)
+			assert.Equal(t, 0, len(got))
+
+			// Terminations which are seen again, such as by a later run, are only recorded once.
+			assert.Nil(t, store.Record(ctx, []Termination{checkout1, payments}))
+			assert.Nil(t, store.Record(ctx, []Termination{checkout1, checkout2, kafka, kafka}))
+
+			tests := map[string]struct {
+				query HistoryQuery
+				want  []Termination
+			}{
+				"everything ordered by time": {
+					query: HistoryQuery{},
+					want:  []Termination{checkout2, payments, checkout1, kafka},
+				},
+				"namespace": {
+					query: HistoryQuery{Namespace: "kafka"},
+					want:  []Termination{kafka},
+				},
+				"owner": {
+					query: HistoryQuery{Owner: "deployment/checkout"},
+					want:  []Termination{checkout2, checkout1},
+				},
+				"time range": {
+					query: HistoryQuery{
+						Since: time.Date(2023, 1, 2, 2, 0, 0, 0, time.UTC),
+						Until: time.Date(2023, 1, 2, 3, 0, 0, 0, time.UTC),
+					},
+					want: []Termination{payments, checkout1},
+				},
+			}
+
+			for name, tc := range tests {
+				t.Run(name, func(t *testing.T) {
+					got, err := store.Query(ctx, tc.query)
+					assert.Nil(t, err)
+					assert.Equal(t, len(tc.want), len(got))
+					for i := range tc.want {
+						assert.Equal(t, tc.want[i].ID(), got[i].ID())
+					}
+				})
+			}
+		})
+	}
+}
+
+func TestConfigMapHistoryLimit(t *testing.T) {
+
+	ctx := context.Background()
+	store := &ConfigMapHistory{Client: fake.NewSimpleClientset(), Namespace: "oomd", Name: "oomd-history", Limit: 2}
+
+	assert.Nil(t, store.Record(ctx, []Termination{
+		historyTermination("shop", "checkout-3", "", 3),
+		historyTermination("shop", "checkout-1", "", 1),
+		historyTermination("shop", "checkout-2", "", 2),
+	}))
+
+	// The oldest termination is dropped.
+	got, err := store.Query(ctx, HistoryQuery{})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(got))
+	assert.Equal(t, "checkout-2", got[0].Pod)
+	assert.Equal(t, "checkout-3", got[1].Pod)
+}
+
+func TestConfigMapHistoryMaxBytes(t *testing.T) {
+
+	ctx := context.Background()
+	store := &ConfigMapHistory{Client: fake.NewSimpleClientset(), Namespace: "oomd", Name: "oomd-history", MaxBytes: 8 * 1024}
+
+	// The message of a container with `FallbackToLogsOnError` is its last logs.
+	var terminations []Termination
+	for i := 0; i < 10; i++ {
+		termination := historyTermination("shop", fmt.Sprintf("checkout-%d", i), "", i)
+		termination.Message = strings.Repeat("x", 2048)
+		terminations = append(terminations, termination)
+	}
+	assert.Nil(t, store.Record(ctx, terminations))
+
+	cm, err := store.Client.CoreV1().ConfigMaps("oomd").Get(ctx, "oomd-history", metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.LessOrEqual(t, len(cm.Data[configMapHistoryKey]), 8*1024)
+
+	// The most recent terminations which fit are kept.
+	got, err := store.Query(ctx, HistoryQuery{})
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(got))
+	assert.Equal(t, "checkout-9", got[2].Pod)
+
+	// Recording carries on working once the limit is reached.
+	assert.Nil(t, store.Record(ctx, []Termination{historyTermination("shop", "checkout-10", "", 10)}))
+}
+
+func TestFileHistoryShared(t *testing.T) {
+
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+
+	checkout := historyTermination("shop", "checkout-1", "", 1)
+	payments := historyTermination("shop", "payments-1", "", 2)
+
+	// Each store is a separate process, such as a watch and a regular run, which
+	// record the same terminations at the same time.
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.Nil(t, (&FileHistory{Path: path}).Record(ctx, []Termination{checkout, payments}))
+		}()
+	}
+	wg.Wait()
+
+	store := &FileHistory{Path: path}
+	assert.Nil(t, store.Record(ctx, []Termination{checkout}))
+
+	// The termination appended by another process is only read once it is there.
+	kafka := historyTermination("kafka", "kafka-0", "", 3)
+	assert.Nil(t, (&FileHistory{Path: path}).Record(ctx, []Termination{kafka}))
+	assert.Nil(t, store.Record(ctx, []Termination{kafka, payments}))
+
+	got, err := store.Query(ctx, HistoryQuery{})
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(got))
+
+	b, err := os.ReadFile(path)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, strings.Count(string(b), "\n"))
+}
+
+func TestFileHistoryCorrupt(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	assert.Nil(t, os.WriteFile(path, []byte("{not json\n"), 0o644))
+
+	_, err := (&FileHistory{Path: path}).Query(context.Background(), HistoryQuery{})
+	assert.NotNil(t, err)
+}
+
+func TestOpenHistoryStore(t *testing.T) {
+
+	client := fake.NewSimpleClientset()
+	getClient := func() (kubernetes.Interface, error) { return client, nil }
+
+	home, err := os.UserHomeDir()
+	assert.Nil(t, err)
+
+	tests := map[string]struct {
+		spec    string
+		want    HistoryStore
+		wantErr bool
+	}{
+		"file": {
+			spec: "file:/tmp/history.jsonl",
+			want: &FileHistory{Path: "/tmp/history.jsonl"},
+		},
+		"file in home directory": {
+			spec: "file:~/.kube/oomd/history.jsonl",
+			want: &FileHistory{Path: filepath.Join(home, ".kube/oomd/history.jsonl")},
+		},
+		"configmap in the current namespace": {
+			spec: "configmap:oomd-history",
+			want: &ConfigMapHistory{Client: client, Namespace: "default", Name: "oomd-history"},
+		},
+		"configmap in another namespace": {
+			spec: "configmap:monitoring/oomd-history",
+			want: &ConfigMapHistory{Client: client, Namespace: "monitoring", Name: "oomd-history"},
+		},
+		"unsupported backend": {
+			spec:    "sqlite:history.db",
+			wantErr: true,
+		},
+		"no location": {
+			spec:    "file",
+			wantErr: true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+
+			store, err := OpenHistoryStore(tc.spec, getClient, "default")
+			if tc.wantErr {
+				assert.NotNil(t, err)
+				return
+			}
+
+			assert.Nil(t, err)
+			assert.Equal(t, tc.want, store)
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+)
+
+// DefaultChunkSize is the number of pods retrieved per page, this is the same
+// default as `kubectl get --chunk-size`.
+const DefaultChunkSize int64 = 500
+
+// errContinueExpired is returned when the continue token has expired again,
+// after the list was already restarted from the beginning.
+var errContinueExpired = errors.New("continue token expired")
+
+// listPodPages pages through the pods matching the list options, calling fn with
+// each page as it arrives so that the full list is never held in memory. A chunk
+// size of 0 retrieves every pod in a single request.
+//
+// Continue tokens expire after a few minutes, which is possible on very large
+// clusters. When this happens, we resume from the inconsistent continue token which
+// the API server returns alongside the error. Otherwise, the list is restarted
+// from the beginning once, so fn must tolerate seeing the same pod more than once.
+//
+// A non-zero request timeout bounds each page individually, rather than the whole
+// list, in the same way as `kubectl get --request-timeout`.
+func listPodPages(ctx context.Context, pods corev1client.PodInterface, listOptions metav1.ListOptions, chunkSize int64, requestTimeout time.Duration, fn func([]v1.Pod) error) error {
+
+	listOptions.Limit = chunkSize
+	restarted := false
+
+	for {
+		page, err := listPodPage(ctx, pods, listOptions, requestTimeout)
+		if err != nil {
+			if !apierrors.IsResourceExpired(err) || listOptions.Continue == "" {
+				return err
+			}
+
+			switch token := inconsistentContinueToken(err); {
+			case token != "":
+				listOptions.Continue = token
+			case !restarted:
+				restarted = true
+				listOptions.Continue = ""
+			default:
+				return fmt.Errorf("%w, try a smaller --chunk-size: %s", errContinueExpired, err)
+			}
+			continue
+		}
+
+		if err := fn(page.Items); err != nil {
+			return err
+		}
+
+		if page.Continue == "" {
+			return nil
+		}
+		listOptions.Continue = page.Continue
+	}
+}
+
+// listPodPage retrieves a single page of pods, bounded by the request timeout.
+func listPodPage(ctx context.Context, pods corev1client.PodInterface, listOptions metav1.ListOptions, requestTimeout time.Duration) (*v1.PodList, error) {
+
+	if requestTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, requestTimeout)
+		defer cancel()
+	}
+
+	return pods.List(ctx, listOptions)
+}
+
+// inconsistentContinueToken returns the continue token which the API server
+// provides with a 410 Gone error, this resumes the list without a consistent
+// snapshot, rather than starting over.
+func inconsistentContinueToken(err error) string {
+
+	var status apierrors.APIStatus
+	if !errors.As(err, &status) {
+		return ""
+	}
+
+	return status.Status().ListMeta.Continue
+}
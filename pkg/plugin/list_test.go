@@ -0,0 +1,156 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	corev1client "k8s.io/client-go/kubernetes/typed/core/v1"
+)
+
+// pagedPods is a fake pod List implementation which honours the limit and continue
+// options, as the fake clientset does not pass them through to its reactors. The
+// continue token is the index of the next pod, and expired tokens return a 410.
+type pagedPods struct {
+	corev1client.PodInterface
+
+	pods    []v1.Pod
+	expired map[string]string // Expired continue tokens, mapped to the inconsistent token to resume from.
+	calls   int
+}
+
+func (l *pagedPods) List(ctx context.Context, opts metav1.ListOptions) (*v1.PodList, error) {
+
+	l.calls++
+
+	start := 0
+	if opts.Continue != "" {
+		if resume, ok := l.expired[opts.Continue]; ok {
+			delete(l.expired, opts.Continue)
+			err := apierrors.NewResourceExpired("continue token expired")
+			err.ErrStatus.ListMeta.Continue = resume
+			return nil, err
+		}
+		fmt.Sscanf(opts.Continue, "%d", &start)
+	}
+
+	end := len(l.pods)
+	if opts.Limit > 0 && start+int(opts.Limit) < end {
+		end = start + int(opts.Limit)
+	}
+
+	list := &v1.PodList{Items: l.pods[start:end]}
+	if end < len(l.pods) {
+		list.Continue = fmt.Sprintf("%d", end)
+	}
+	return list, nil
+}
+
+func TestListPodPages(t *testing.T) {
+
+	var pods []v1.Pod
+	for i := 0; i < 5; i++ {
+		pods = append(pods, v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("pod-%d", i), UID: types.UID(fmt.Sprint(i))}})
+	}
+
+	tests := map[string]struct {
+		chunkSize int64
+		expired   map[string]string
+		wantCalls int
+		wantPods  []string
+	}{
+		"single request without chunking": {
+			chunkSize: 0,
+			wantCalls: 1,
+			wantPods:  []string{"pod-0", "pod-1", "pod-2", "pod-3", "pod-4"},
+		},
+		"paged": {
+			chunkSize: 2,
+			wantCalls: 3,
+			wantPods:  []string{"pod-0", "pod-1", "pod-2", "pod-3", "pod-4"},
+		},
+		"expired token resumes from inconsistent token": {
+			chunkSize: 2,
+			expired:   map[string]string{"2": "2"},
+			wantCalls: 4,
+			wantPods:  []string{"pod-0", "pod-1", "pod-2", "pod-3", "pod-4"},
+		},
+		"expired token without inconsistent token restarts": {
+			chunkSize: 2,
+			expired:   map[string]string{"2": ""},
+			wantCalls: 5,
+			wantPods:  []string{"pod-0", "pod-1", "pod-0", "pod-1", "pod-2", "pod-3", "pod-4"},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+
+			lister := &pagedPods{pods: pods, expired: tc.expired}
+
+			var got []string
+			err := listPodPages(context.Background(), lister, metav1.ListOptions{}, tc.chunkSize, 0, func(page []v1.Pod) error {
+				if tc.chunkSize > 0 {
+					assert.LessOrEqual(t, int64(len(page)), tc.chunkSize)
+				}
+				for _, p := range page {
+					got = append(got, p.Name)
+				}
+				return nil
+			})
+
+			assert.Nil(t, err)
+			assert.Equal(t, tc.wantPods, got)
+			assert.Equal(t, tc.wantCalls, lister.calls)
+		})
+	}
+}
+
+func TestListPodPagesExpiredTwice(t *testing.T) {
+
+	var pods []v1.Pod
+	for i := 0; i < 3; i++ {
+		pods = append(pods, v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("pod-%d", i)}})
+	}
+
+	// The continuation expires on both the first attempt and the restarted list.
+	lister := &pagedPods{pods: pods, expired: map[string]string{"1": ""}}
+	err := listPodPages(context.Background(), lister, metav1.ListOptions{}, 1, 0, func([]v1.Pod) error {
+		lister.expired["1"] = ""
+		return nil
+	})
+
+	assert.ErrorIs(t, err, errContinueExpired)
+}
+
+// blockingPods is a fake pod List implementation which never responds, like an
+// unresponsive API server, returning only once the context is done.
+type blockingPods struct {
+	corev1client.PodInterface
+}
+
+func (blockingPods) List(ctx context.Context, opts metav1.ListOptions) (*v1.PodList, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestListPodPagesCancelled(t *testing.T) {
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := listPodPages(ctx, blockingPods{}, metav1.ListOptions{}, 1, 0, func([]v1.Pod) error { return nil })
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestListPodPagesRequestTimeout(t *testing.T) {
+
+	err := listPodPages(context.Background(), blockingPods{}, metav1.ListOptions{}, 1, 10*time.Millisecond, func([]v1.Pod) error { return nil })
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
@@ -0,0 +1,80 @@
+package plugin
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	v1 "k8s.io/api/core/v1"
+)
+
+// metricsNamespace prefixes every metric which is exported.
+const metricsNamespace = "oomd"
+
+// Metrics is a TerminationHandler which exports the terminated containers from a
+// watch as Prometheus metrics.
+type Metrics struct {
+	oomKills    *prometheus.CounterVec
+	memoryLimit *prometheus.GaugeVec
+}
+
+// NewMetrics returns the Metrics, registered with the given registerer.
+func NewMetrics(registerer prometheus.Registerer) (*Metrics, error) {
+
+	labels := []string{"namespace", "pod", "container", "owner"}
+
+	m := &Metrics{
+		oomKills: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "container_oom_kills_total",
+			Help:      "Number of times a container has been OOMKilled, the owner is the workload which the pod belongs to.",
+		}, labels),
+		memoryLimit: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      "container_memory_limit_bytes",
+			Help:      "Memory limit of a container which has been OOMKilled, this is not exported for containers without a limit.",
+		}, labels),
+	}
+
+	for _, c := range []prometheus.Collector{m.oomKills, m.memoryLimit} {
+		if err := registerer.Register(c); err != nil {
+			return nil, err
+		}
+	}
+
+	return m, nil
+}
+
+// OnTermination implements TerminationHandler. Only containers which were OOMKilled
+// are counted, other kills such as failed liveness probes are reported without
+// `--strict` but are not OOMs.
+func (m *Metrics) OnTermination(t TerminatedPodInfo) error {
+
+	if t.Category != CategoryOOMKilled {
+		return nil
+	}
+
+	labels := prometheus.Labels{
+		"namespace": t.Pod.Namespace,
+		"pod":       t.Pod.Name,
+		"container": t.ContainerName,
+		"owner":     t.Owner,
+	}
+
+	m.oomKills.With(labels).Inc()
+
+	if !t.Memory.limit.IsZero() {
+		m.memoryLimit.With(labels).Set(float64(t.Memory.limit.Value()))
+	}
+
+	return nil
+}
+
+// OnDelete implements TerminationHandler, the metrics of deleted pods are removed
+// so that the number of series does not grow forever as pods are replaced.
+func (m *Metrics) OnDelete(pod v1.Pod) error {
+
+	labels := prometheus.Labels{"namespace": pod.Namespace, "pod": pod.Name}
+
+	m.oomKills.DeletePartialMatch(labels)
+	m.memoryLimit.DeletePartialMatch(labels)
+
+	return nil
+}
@@ -0,0 +1,65 @@
+package plugin
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jdockerty/kubectl-oomd/internal/testutil"
+	"github.com/prometheus/client_golang/prometheus"
+	promtestutil "github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestMetrics(t *testing.T) {
+
+	registry := prometheus.NewRegistry()
+	metrics, err := NewMetrics(registry)
+	assert.Nil(t, err)
+
+	checkout := testutil.Pod("shop", "checkout-1", 137, "OOMKilled")
+	unlimited := testutil.Pod("shop", "payments-1", 137, "OOMKilled")
+
+	terminations := func(pod *v1.Pod) TerminatedPods {
+		pods, err := buildTerminatedPodsInfo([]v1.Pod{*pod}, DefaultClassifier{})
+		assert.Nil(t, err)
+		return pods
+	}
+
+	// The same container is killed twice.
+	for _, p := range append(terminations(checkout), terminations(checkout)...) {
+		assert.Nil(t, metrics.OnTermination(p))
+	}
+
+	// Other kills, such as a failed liveness probe, are not OOMs.
+	for _, p := range terminations(testutil.Pod("shop", "probed-1", 137, "Error")) {
+		assert.Equal(t, CategorySIGKILL, p.Category)
+		assert.Nil(t, metrics.OnTermination(p))
+	}
+
+	unlimited.Spec.Containers[0].Resources.Limits = nil
+	for _, p := range terminations(unlimited) {
+		assert.Nil(t, metrics.OnTermination(p))
+	}
+
+	want := `
+# HELP oomd_container_memory_limit_bytes Memory limit of a container which has been OOMKilled, this is not exported for containers without a limit.
+# TYPE oomd_container_memory_limit_bytes gauge
+oomd_container_memory_limit_bytes{container="app",namespace="shop",owner="",pod="checkout-1"} 1.34217728e+08
+# HELP oomd_container_oom_kills_total Number of times a container has been OOMKilled, the owner is the workload which the pod belongs to.
+# TYPE oomd_container_oom_kills_total counter
+oomd_container_oom_kills_total{container="app",namespace="shop",owner="",pod="checkout-1"} 2
+oomd_container_oom_kills_total{container="app",namespace="shop",owner="",pod="payments-1"} 1
+`
+	assert.Nil(t, promtestutil.GatherAndCompare(registry, strings.NewReader(want)))
+
+	// Deleted pods are no longer exported.
+	assert.Nil(t, metrics.OnDelete(*checkout))
+
+	want = `
+# HELP oomd_container_oom_kills_total Number of times a container has been OOMKilled, the owner is the workload which the pod belongs to.
+# TYPE oomd_container_oom_kills_total counter
+oomd_container_oom_kills_total{container="app",namespace="shop",owner="",pod="payments-1"} 1
+`
+	assert.Nil(t, promtestutil.GatherAndCompare(registry, strings.NewReader(want)))
+}
@@ -0,0 +1,476 @@
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// WebhookFormat is the payload format which is sent to a webhook.
+type WebhookFormat string
+
+const (
+	// WebhookFormatJSON sends the Termination, along with its ID.
+	WebhookFormatJSON WebhookFormat = "json"
+
+	// WebhookFormatSlack sends a message which is compatible with Slack's incoming webhooks.
+	WebhookFormatSlack WebhookFormat = "slack"
+
+	// WebhookFormatCloudEvents sends a CloudEvent in the structured JSON format,
+	// where the data is the same as WebhookFormatJSON.
+	WebhookFormatCloudEvents WebhookFormat = "cloudevents"
+)
+
+// CloudEventType is the type of the CloudEvents which are sent.
+const CloudEventType = "dev.jdockerty.oomd.termination"
+
+const (
+	// DefaultWebhookTimeout is the timeout of each request to a webhook.
+	DefaultWebhookTimeout = 10 * time.Second
+
+	// DefaultNotifyQueueSize is the number of terminations which can be waiting to
+	// be sent by a Handler before new ones are dropped.
+	DefaultNotifyQueueSize = 1000
+)
+
+// webhookTemplates are the payload templates for each format, these are given a
+// Notification. The `json` function encodes a value as JSON.
+var webhookTemplates = map[WebhookFormat]string{
+	WebhookFormatJSON: `{{ json . }}`,
+
+	WebhookFormatSlack: `
+{{- $owner := "" }}{{ with .Owner }}{{ $owner = printf " (%s)" . }}{{ end }}
+{{- $limit := "no memory limit" }}{{ with .Memory.Limit }}{{ $limit = printf "memory limit %s" .Quantity }}{{ end }}
+{{- $suppressed := "" }}{{ with .Suppressed }}{{ $suppressed = printf ", %d more were suppressed" . }}{{ end -}}
+{"text": {{ printf "*%s*: container ` + "`%s`" + ` in pod ` + "`%s/%s`" + `%s was terminated on node ` + "`%s`" + ` with %s%s" .Category .Container .Namespace .Pod $owner .Node $limit $suppressed | json }}}`,
+
+	WebhookFormatCloudEvents: `{
+  "specversion": "1.0",
+  "id": {{ json .ID }},
+  "source": "kubectl-oomd",
+  "type": "` + CloudEventType + `",
+  "subject": {{ printf "%s/%s/%s" .Namespace .Pod .Container | json }},
+  "time": {{ json .TerminatedTime }},
+  "datacontenttype": "application/json",
+  "data": {{ json . }}
+}`,
+}
+
+// webhookContentTypes are the content types for each format.
+var webhookContentTypes = map[WebhookFormat]string{
+	WebhookFormatJSON:        "application/json",
+	WebhookFormatSlack:       "application/json",
+	WebhookFormatCloudEvents: "application/cloudevents+json",
+}
+
+// WebhookFormats returns the supported webhook formats, sorted by name.
+func WebhookFormats() []string {
+
+	formats := make([]string, 0, len(webhookTemplates))
+	for f := range webhookTemplates {
+		formats = append(formats, string(f))
+	}
+	sort.Strings(formats)
+
+	return formats
+}
+
+// Notification is the data given to the payload templates.
+type Notification struct {
+	Termination `json:",inline"`
+
+	// ID uniquely identifies the termination, this is the same when it is sent again.
+	ID string `json:"id"`
+
+	// Suppressed is the number of notifications for the same workload which were
+	// not sent since the previous one, because of the rate limit.
+	Suppressed int `json:"suppressed,omitempty"`
+}
+
+// NotifierOptions configures where and how often notifications are sent.
+type NotifierOptions struct {
+	// URLs of the webhooks which every notification is sent to.
+	URLs []string
+
+	// Format of the payload, WebhookFormatJSON is used when empty.
+	Format WebhookFormat
+
+	// Template overrides the payload of the format, the content type of the
+	// format is still used. This is a Go template which is given a Notification.
+	Template string
+
+	// RateLimit is the minimum time between notifications for the same workload,
+	// those within this time are counted and included in the next notification.
+	// When there is not another termination, the most recent one is sent once the
+	// rate limit has passed. 0 sends every notification.
+	RateLimit time.Duration
+
+	// Retries is the number of times a failed notification is retried, when the
+	// webhook cannot be reached or responds with a 5xx or 429 status.
+	Retries int
+
+	// Backoff is the time waited before the first retry, this doubles with each retry.
+	Backoff time.Duration
+
+	// Since skips terminations before this time, such as those which already
+	// existed when the watch started. Every termination is sent when zero.
+	Since time.Time
+
+	// Timeout of each request to a webhook, DefaultWebhookTimeout is used when
+	// zero. This is not used when a Client is given.
+	Timeout time.Duration
+
+	// QueueSize is the number of terminations which can be waiting to be sent by a
+	// Handler, DefaultNotifyQueueSize is used when zero.
+	QueueSize int
+
+	// Client sends the requests, a client with the Timeout is used when nil.
+	Client *http.Client
+}
+
+// Notifier sends each new termination to the configured webhooks. Terminations
+// are deduplicated by the watch, so each one is only sent once.
+type Notifier struct {
+	opts        NotifierOptions
+	payload     *template.Template
+	contentType string
+	now         func() time.Time
+
+	mu         sync.Mutex
+	lastSent   map[string]time.Time        // When a notification was last sent for each workload.
+	suppressed map[string]suppressedNotify // Notifications not sent for each workload since then.
+}
+
+// suppressedNotify is the terminations of a workload which were not sent because of
+// the rate limit, the latest is sent once it has passed.
+type suppressedNotify struct {
+	latest TerminatedPodInfo
+	count  int
+}
+
+// NewNotifier returns a Notifier, the payload template is parsed straight away
+// so that mistakes are surfaced before any terminations happen.
+func NewNotifier(opts NotifierOptions) (*Notifier, error) {
+
+	if opts.Format == "" {
+		opts.Format = WebhookFormatJSON
+	}
+
+	text, ok := webhookTemplates[opts.Format]
+	if !ok {
+		return nil, fmt.Errorf("%s is not a supported webhook format. One of: (%s)", opts.Format, strings.Join(WebhookFormats(), ", "))
+	}
+
+	if opts.Template != "" {
+		text = opts.Template
+	}
+
+	payload, err := template.New(string(opts.Format)).Option("missingkey=error").Funcs(template.FuncMap{
+		"json": func(v interface{}) (string, error) {
+			b, err := json.Marshal(v)
+			return string(b), err
+		},
+	}).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid webhook template: %w", err)
+	}
+
+	for _, u := range opts.URLs {
+		if _, err := url.ParseRequestURI(u); err != nil {
+			return nil, fmt.Errorf("invalid webhook URL: %w", err)
+		}
+	}
+
+	if opts.Timeout == 0 {
+		opts.Timeout = DefaultWebhookTimeout
+	}
+
+	if opts.QueueSize == 0 {
+		opts.QueueSize = DefaultNotifyQueueSize
+	}
+
+	if opts.Client == nil {
+		opts.Client = &http.Client{Timeout: opts.Timeout}
+	}
+
+	return &Notifier{
+		opts:        opts,
+		payload:     payload,
+		contentType: webhookContentTypes[opts.Format],
+		now:         time.Now,
+		lastSent:    make(map[string]time.Time),
+		suppressed:  make(map[string]suppressedNotify),
+	}, nil
+}
+
+// Handler returns a TerminationHandler which notifies of each termination from a
+// watch. The terminations are queued and sent by a goroutine until the context is
+// cancelled, so that a slow webhook does not hold up the watch. Failed notifications
+// do not stop the watch, they are passed to onError along with terminations dropped
+// because the queue is full, apart from those which were interrupted by the watch
+// stopping.
+func (n *Notifier) Handler(ctx context.Context, onError func(error)) TerminationHandler {
+
+	report := func(err error) {
+		if err != nil && ctx.Err() == nil && onError != nil {
+			onError(err)
+		}
+	}
+
+	queue := make(chan TerminatedPodInfo, n.opts.QueueSize)
+	go n.run(ctx, queue, report)
+
+	return TerminationHandlerFuncs{
+		TerminationFunc: func(t TerminatedPodInfo) error {
+			select {
+			case queue <- t:
+			default:
+				report(fmt.Errorf("notification queue is full, dropped the termination of %s/%s", t.Pod.Namespace, t.Pod.Name))
+			}
+			return nil
+		},
+	}
+}
+
+// run sends the queued terminations, along with those which were suppressed once
+// the rate limit of their workload has passed, until the context is cancelled.
+func (n *Notifier) run(ctx context.Context, queue <-chan TerminatedPodInfo, report func(error)) {
+
+	for {
+		var timer *time.Timer
+		var flush <-chan time.Time
+		if at, ok := n.nextFlush(); ok {
+			timer = time.NewTimer(at.Sub(n.now()))
+			flush = timer.C
+		}
+
+		select {
+		case <-ctx.Done():
+		case t := <-queue:
+			report(n.Notify(ctx, t))
+		case <-flush:
+			report(n.flush(ctx))
+		}
+
+		if timer != nil {
+			timer.Stop()
+		}
+
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// Notify sends the termination to every webhook, unless the workload has been
+// notified of within the rate limit. The errors from every webhook are returned.
+func (n *Notifier) Notify(ctx context.Context, t TerminatedPodInfo) error {
+
+	notification, ok := n.notification(t)
+	if !ok {
+		return nil
+	}
+
+	return n.sendAll(ctx, notification)
+}
+
+// sendAll renders the notification and sends it to every webhook.
+func (n *Notifier) sendAll(ctx context.Context, notification Notification) error {
+
+	var payload bytes.Buffer
+	if err := n.payload.Execute(&payload, notification); err != nil {
+		return fmt.Errorf("unable to render webhook payload for %s/%s: %w", notification.Namespace, notification.Pod, err)
+	}
+
+	var errs []error
+	for _, u := range n.opts.URLs {
+		if err := n.send(ctx, u, payload.Bytes()); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// notification returns the Notification for the termination, or false when it
+// is too old or the workload's rate limit has not yet passed.
+func (n *Notifier) notification(t TerminatedPodInfo) (Notification, bool) {
+
+	if t.terminatedTime.Before(n.opts.Since) {
+		return Notification{}, false
+	}
+
+	// Pods without an owner are rate limited on their own.
+	workload := t.Pod.Namespace + "/" + t.workload()
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	now := n.now()
+	if last, ok := n.lastSent[workload]; ok && now.Sub(last) < n.opts.RateLimit {
+		n.suppressed[workload] = suppressedNotify{latest: t, count: n.suppressed[workload].count + 1}
+		return Notification{}, false
+	}
+
+	suppressed := n.suppressed[workload].count
+	n.lastSent[workload] = now
+	delete(n.suppressed, workload)
+
+	return newNotification(t, suppressed), true
+}
+
+// nextFlush returns when the rate limit of the next workload with suppressed
+// notifications passes, or false when there are none.
+func (n *Notifier) nextFlush() (time.Time, bool) {
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	var next time.Time
+	for workload := range n.suppressed {
+		at := n.lastSent[workload].Add(n.opts.RateLimit)
+		if next.IsZero() || at.Before(next) {
+			next = at
+		}
+	}
+
+	return next, !next.IsZero()
+}
+
+// flush sends the latest suppressed termination of each workload whose rate limit
+// has passed without another termination, so that the suppressed count is not lost
+// when the workload does not OOM again.
+func (n *Notifier) flush(ctx context.Context) error {
+
+	n.mu.Lock()
+
+	now := n.now()
+	var notifications []Notification
+	for workload, s := range n.suppressed {
+		if now.Sub(n.lastSent[workload]) < n.opts.RateLimit {
+			continue
+		}
+
+		// The latest termination is sent, so is no longer counted as suppressed.
+		notifications = append(notifications, newNotification(s.latest, s.count-1))
+		n.lastSent[workload] = now
+		delete(n.suppressed, workload)
+	}
+
+	n.mu.Unlock()
+
+	var errs []error
+	for _, notification := range notifications {
+		if err := n.sendAll(ctx, notification); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// newNotification returns the Notification of a termination.
+func newNotification(t TerminatedPodInfo, suppressed int) Notification {
+
+	termination := t.ToTermination()
+	return Notification{
+		Termination: termination,
+		ID:          termination.ID(),
+		Suppressed:  suppressed,
+	}
+}
+
+// webhookStatusError is returned when a webhook responds with an unsuccessful status.
+type webhookStatusError struct {
+	status int
+}
+
+func (e webhookStatusError) Error() string {
+	return fmt.Sprintf("unexpected status %d %s", e.status, http.StatusText(e.status))
+}
+
+// retryable returns whether a failed request should be retried, this is when the
+// webhook could not be reached, including when it timed out, or may succeed later.
+// Nothing is retried once the context is done.
+func retryable(ctx context.Context, err error) bool {
+
+	var statusErr webhookStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.status >= http.StatusInternalServerError || statusErr.status == http.StatusTooManyRequests
+	}
+
+	return ctx.Err() == nil
+}
+
+// send posts the payload to the webhook, retrying with an exponential backoff.
+func (n *Notifier) send(ctx context.Context, webhook string, payload []byte) error {
+
+	backoff := n.opts.Backoff
+
+	for attempt := 0; ; attempt++ {
+
+		err := n.post(ctx, webhook, payload)
+		if err == nil {
+			return nil
+		}
+
+		if attempt >= n.opts.Retries || !retryable(ctx, err) {
+			return fmt.Errorf("failed to notify webhook %s after %d attempt(s): %w", redactURL(webhook), attempt+1, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("failed to notify webhook %s: %w", redactURL(webhook), ctx.Err())
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// post sends a single request to the webhook.
+func (n *Notifier) post(ctx context.Context, webhook string, payload []byte) error {
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", n.contentType)
+
+	resp, err := n.opts.Client.Do(req)
+	if err != nil {
+		// The error contains the full URL, which may include a secret token.
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			return urlErr.Err
+		}
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return webhookStatusError{status: resp.StatusCode}
+	}
+
+	return nil
+}
+
+// redactURL removes everything but the scheme and host from a webhook URL, as
+// the path often contains a secret token, such as with Slack.
+func redactURL(webhook string) string {
+
+	u, err := url.Parse(webhook)
+	if err != nil {
+		return "<invalid URL>"
+	}
+
+	return u.Scheme + "://" + u.Host
+}
@@ -0,0 +1,351 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jdockerty/kubectl-oomd/internal/testutil"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// webhookServer records the requests it receives, responding with each status in
+// turn and then 200 OK.
+type webhookServer struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	statuses []int
+	requests []*http.Request
+	bodies   []string
+}
+
+func newWebhookServer(statuses ...int) *webhookServer {
+
+	s := &webhookServer{statuses: statuses}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		body, _ := io.ReadAll(r.Body)
+		s.requests = append(s.requests, r)
+		s.bodies = append(s.bodies, string(body))
+
+		if len(s.statuses) > 0 {
+			w.WriteHeader(s.statuses[0])
+			s.statuses = s.statuses[1:]
+		}
+	}))
+
+	return s
+}
+
+// notificationPod returns a pod owned by the checkout Deployment, whose container
+// was OOMKilled.
+func notificationPod(name string) TerminatedPodInfo {
+
+	controller := true
+	pod := testutil.Pod("shop", name, 137, "OOMKilled")
+	pod.Labels = map[string]string{"pod-template-hash": "5bcbcdf97"}
+	pod.OwnerReferences = []metav1.OwnerReference{{Kind: "ReplicaSet", Name: "checkout-5bcbcdf97", Controller: &controller}}
+	pod.Spec.NodeName = "node-1"
+	pod.Status.ContainerStatuses[0].LastTerminationState.Terminated.FinishedAt = metav1.NewTime(time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC))
+
+	pods, _ := buildTerminatedPodsInfo([]v1.Pod{*pod}, DefaultClassifier{})
+	_ = resolveOwners(context.Background(), testOwnerResolver(), pods)
+	return pods[0]
+}
+
+func TestNotifierFormats(t *testing.T) {
+
+	tests := map[string]struct {
+		format      WebhookFormat
+		template    string
+		contentType string
+		check       func(t *testing.T, body string)
+	}{
+		"json": {
+			format:      WebhookFormatJSON,
+			contentType: "application/json",
+			check: func(t *testing.T, body string) {
+				var n Notification
+				assert.Nil(t, json.Unmarshal([]byte(body), &n))
+				assert.Equal(t, "checkout-1", n.Pod)
+				assert.Equal(t, "Deployment/checkout", n.Owner)
+				assert.Equal(t, TerminationKind, n.Kind)
+				assert.Equal(t, "shop/checkout-1/app/1672628645", n.ID)
+			},
+		},
+		"slack": {
+			format:      WebhookFormatSlack,
+			contentType: "application/json",
+			check: func(t *testing.T, body string) {
+				assert.JSONEq(t, `{"text": "*OOMKilled*: container `+"`app`"+` in pod `+"`shop/checkout-1`"+` (Deployment/checkout) was terminated on node `+"`node-1`"+` with memory limit 128Mi"}`, body)
+			},
+		},
+		"cloudevents": {
+			format:      WebhookFormatCloudEvents,
+			contentType: "application/cloudevents+json",
+			check: func(t *testing.T, body string) {
+				var event struct {
+					SpecVersion string       `json:"specversion"`
+					ID          string       `json:"id"`
+					Type        string       `json:"type"`
+					Subject     string       `json:"subject"`
+					Time        string       `json:"time"`
+					Data        Notification `json:"data"`
+				}
+				assert.Nil(t, json.Unmarshal([]byte(body), &event))
+				assert.Equal(t, "1.0", event.SpecVersion)
+				assert.Equal(t, "shop/checkout-1/app/1672628645", event.ID)
+				assert.Equal(t, CloudEventType, event.Type)
+				assert.Equal(t, "shop/checkout-1/app", event.Subject)
+				assert.Equal(t, "2023-01-02T03:04:05Z", event.Time)
+				assert.Equal(t, "checkout-1", event.Data.Pod)
+			},
+		},
+		"custom template": {
+			format:      WebhookFormatSlack,
+			template:    `{"text": {{ printf "%s was %s" .Pod .Category | json }}}`,
+			contentType: "application/json",
+			check: func(t *testing.T, body string) {
+				assert.JSONEq(t, `{"text": "checkout-1 was OOMKilled"}`, body)
+			},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+
+			server := newWebhookServer()
+			defer server.Close()
+
+			notifier, err := NewNotifier(NotifierOptions{URLs: []string{server.URL}, Format: tc.format, Template: tc.template})
+			assert.Nil(t, err)
+
+			assert.Nil(t, notifier.Notify(context.Background(), notificationPod("checkout-1")))
+
+			assert.Equal(t, 1, len(server.requests))
+			assert.Equal(t, tc.contentType, server.requests[0].Header.Get("Content-Type"))
+			tc.check(t, server.bodies[0])
+		})
+	}
+}
+
+func TestNotifierRetries(t *testing.T) {
+
+	tests := map[string]struct {
+		statuses  []int
+		retries   int
+		wantCalls int
+		wantErr   bool
+	}{
+		"succeeds after server errors": {
+			statuses:  []int{http.StatusInternalServerError, http.StatusTooManyRequests},
+			retries:   2,
+			wantCalls: 3,
+		},
+		"gives up after retries": {
+			statuses:  []int{http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway},
+			retries:   2,
+			wantCalls: 3,
+			wantErr:   true,
+		},
+		"client errors are not retried": {
+			statuses:  []int{http.StatusNotFound},
+			retries:   2,
+			wantCalls: 1,
+			wantErr:   true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+
+			server := newWebhookServer(tc.statuses...)
+			defer server.Close()
+
+			notifier, err := NewNotifier(NotifierOptions{URLs: []string{server.URL + "/secret-token"}, Retries: tc.retries, Backoff: time.Millisecond})
+			assert.Nil(t, err)
+
+			err = notifier.Notify(context.Background(), notificationPod("checkout-1"))
+			if tc.wantErr {
+				assert.NotNil(t, err)
+				assert.NotContains(t, err.Error(), "secret-token", "webhook URLs may contain secrets")
+			} else {
+				assert.Nil(t, err)
+			}
+
+			assert.Equal(t, tc.wantCalls, len(server.requests))
+		})
+	}
+}
+
+func TestNotifierRateLimit(t *testing.T) {
+
+	server := newWebhookServer()
+	defer server.Close()
+
+	notifier, err := NewNotifier(NotifierOptions{URLs: []string{server.URL}, Format: WebhookFormatSlack, RateLimit: time.Minute})
+	assert.Nil(t, err)
+
+	now := time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)
+	notifier.now = func() time.Time { return now }
+
+	// Pods from the same Deployment share the rate limit.
+	for _, name := range []string{"checkout-1", "checkout-2", "checkout-3"} {
+		assert.Nil(t, notifier.Notify(context.Background(), notificationPod(name)))
+	}
+	assert.Equal(t, 1, len(server.requests))
+
+	now = now.Add(time.Minute)
+	assert.Nil(t, notifier.Notify(context.Background(), notificationPod("checkout-4")))
+
+	assert.Equal(t, 2, len(server.requests))
+	assert.True(t, strings.Contains(server.bodies[1], "2 more were suppressed"), server.bodies[1])
+}
+
+func TestNotifierFlushesSuppressed(t *testing.T) {
+
+	server := newWebhookServer()
+	defer server.Close()
+
+	notifier, err := NewNotifier(NotifierOptions{URLs: []string{server.URL}, Format: WebhookFormatSlack, RateLimit: time.Minute})
+	assert.Nil(t, err)
+
+	now := time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)
+	notifier.now = func() time.Time { return now }
+
+	for _, name := range []string{"checkout-1", "checkout-2", "checkout-3"} {
+		assert.Nil(t, notifier.Notify(context.Background(), notificationPod(name)))
+	}
+
+	at, ok := notifier.nextFlush()
+	assert.True(t, ok)
+	assert.Equal(t, now.Add(time.Minute), at)
+
+	// Nothing is flushed before the rate limit has passed.
+	assert.Nil(t, notifier.flush(context.Background()))
+	assert.Equal(t, 1, len(server.requests))
+
+	// The workload does not OOM again, so the latest suppressed termination is sent
+	// once the rate limit has passed.
+	now = now.Add(time.Minute)
+	assert.Nil(t, notifier.flush(context.Background()))
+
+	assert.Equal(t, 2, len(server.requests))
+	assert.True(t, strings.Contains(server.bodies[1], "checkout-3"), server.bodies[1])
+	assert.True(t, strings.Contains(server.bodies[1], "1 more were suppressed"), server.bodies[1])
+
+	_, ok = notifier.nextFlush()
+	assert.False(t, ok)
+}
+
+func TestNotifierHandler(t *testing.T) {
+
+	server := newWebhookServer()
+	defer server.Close()
+
+	notifier, err := NewNotifier(NotifierOptions{URLs: []string{server.URL}, RateLimit: 50 * time.Millisecond})
+	assert.Nil(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	handler := notifier.Handler(ctx, func(err error) { t.Error(err) })
+	assert.Nil(t, handler.OnTermination(notificationPod("checkout-1")))
+	assert.Nil(t, handler.OnTermination(notificationPod("checkout-2")))
+
+	// The second termination is sent once the rate limit has passed.
+	assert.Eventually(t, func() bool {
+		server.mu.Lock()
+		defer server.mu.Unlock()
+		return len(server.bodies) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestNotifierSlowWebhook(t *testing.T) {
+
+	received := make(chan struct{}, 10)
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- struct{}{}
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	notifier, err := NewNotifier(NotifierOptions{URLs: []string{server.URL}, Timeout: 50 * time.Millisecond, Retries: 2, Backoff: time.Millisecond})
+	assert.Nil(t, err)
+
+	// A webhook which does not respond times out, which is retried.
+	err = notifier.Notify(context.Background(), notificationPod("checkout-1"))
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "after 3 attempt(s)")
+	for i := 0; i < 3; i++ {
+		<-received
+	}
+
+	notifier, err = NewNotifier(NotifierOptions{URLs: []string{server.URL}, QueueSize: 1})
+	assert.Nil(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var mu sync.Mutex
+	var errs []error
+	handler := notifier.Handler(ctx, func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		errs = append(errs, err)
+	})
+
+	// Whilst the webhook is busy with the first termination, the second is queued
+	// and the third is dropped, rather than holding up the watch.
+	assert.Nil(t, handler.OnTermination(notificationPod("checkout-2")))
+	<-received
+	assert.Nil(t, handler.OnTermination(notificationPod("checkout-3")))
+	assert.Nil(t, handler.OnTermination(notificationPod("checkout-4")))
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, 1, len(errs))
+	assert.Contains(t, errs[0].Error(), "checkout-4")
+}
+
+func TestNotifierSince(t *testing.T) {
+
+	server := newWebhookServer()
+	defer server.Close()
+
+	since := time.Date(2023, 1, 2, 3, 4, 6, 0, time.UTC)
+	notifier, err := NewNotifier(NotifierOptions{URLs: []string{server.URL}, Since: since})
+	assert.Nil(t, err)
+
+	// The termination finished a second before the notifier started.
+	assert.Nil(t, notifier.Notify(context.Background(), notificationPod("checkout-1")))
+	assert.Equal(t, 0, len(server.requests))
+}
+
+func TestNewNotifierInvalid(t *testing.T) {
+
+	_, err := NewNotifier(NotifierOptions{Format: "xml"})
+	assert.NotNil(t, err)
+
+	_, err = NewNotifier(NotifierOptions{Template: "{{ .Pod "})
+	assert.NotNil(t, err)
+
+	_, err = NewNotifier(NotifierOptions{URLs: []string{"not a url"}})
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,120 @@
+package plugin
+
+import (
+	"fmt"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// Options configures which pods are retrieved and how their terminations are classified.
+type Options struct {
+	// Namespace to retrieve pods from, metav1.NamespaceAll retrieves them from every namespace.
+	Namespace string
+
+	// LabelSelector restricts the pods by their labels, such as `app=checkout`.
+	LabelSelector string
+
+	// FieldSelector restricts the pods by their fields, such as `status.phase=Running`.
+	FieldSelector string
+
+	// NodeName restricts the pods to those scheduled onto the node, this is
+	// combined with the FieldSelector.
+	NodeName string
+
+	// Targets restricts the pods to those belonging to the resources given as
+	// arguments, every pod matching the other options is used when empty.
+	Targets []Target
+
+	// ChunkSize is the number of pods retrieved per page, 0 retrieves every pod in a single request.
+	ChunkSize int64
+
+	// RequestTimeout bounds each API call, such as a single page of pods, 0 waits
+	// for as long as the context allows. This mirrors `--request-timeout`.
+	RequestTimeout time.Duration
+
+	// MemoryUsage retrieves the current memory usage of the terminated containers
+	// from the metrics API, when it is available.
+	MemoryUsage bool
+
+	// Prometheus retrieves the peak memory of the terminated containers and how
+	// quickly it grew before they were terminated, this is skipped when nil.
+	Prometheus *Prometheus
+
+	// Owners resolves the top-level workload which owns each terminated pod, such
+	// as the Deployment of a ReplicaSet or the CronJob of a Job, for both Run and a
+	// watch. The owners are left empty when nil, as resolving them lists the owners
+	// of the pods.
+	Owners *OwnerResolver
+
+	// OnWatchError is called with the errors which a watch recovers from, such as
+	// being unable to resolve the owner of a pod, these are ignored when nil.
+	OnWatchError func(error)
+
+	// Classifier decides which terminations are reported, the DefaultClassifier is used when nil.
+	Classifier TerminationClassifier
+
+	// Since and Until are the inclusive time range the containers were terminated
+	// in, either may be zero to leave that end of the range open.
+	Since time.Time
+	Until time.Time
+}
+
+// inWindow returns whether the container was terminated between Since and Until.
+func (o Options) inWindow(t TerminatedPodInfo) bool {
+
+	if !o.Since.IsZero() && t.terminatedTime.Before(o.Since) {
+		return false
+	}
+
+	if !o.Until.IsZero() && t.terminatedTime.After(o.Until) {
+		return false
+	}
+
+	return true
+}
+
+// watchError passes an error which a watch recovers from to OnWatchError, if set.
+func (o Options) watchError(err error) {
+	if o.OnWatchError != nil {
+		o.OnWatchError(err)
+	}
+}
+
+// classifier returns the configured classifier, falling back to the DefaultClassifier.
+func (o Options) classifier() TerminationClassifier {
+	if o.Classifier == nil {
+		return DefaultClassifier{}
+	}
+	return o.Classifier
+}
+
+// ListOptions returns the options used to list pods, the selectors are pushed
+// down to the API server so that only the matching pods are returned.
+func (o Options) ListOptions() (metav1.ListOptions, error) {
+
+	if _, err := labels.Parse(o.LabelSelector); err != nil {
+		return metav1.ListOptions{}, fmt.Errorf("invalid label selector %q: %w", o.LabelSelector, err)
+	}
+
+	fieldSelector, err := fields.ParseSelector(o.FieldSelector)
+	if err != nil {
+		return metav1.ListOptions{}, fmt.Errorf("invalid field selector %q: %w", o.FieldSelector, err)
+	}
+
+	if o.NodeName != "" {
+		nodeSelector := fields.OneTermEqualSelector("spec.nodeName", o.NodeName)
+		if fieldSelector.Empty() {
+			fieldSelector = nodeSelector
+		} else {
+			fieldSelector = fields.AndSelectors(fieldSelector, nodeSelector)
+		}
+	}
+
+	return metav1.ListOptions{
+		LabelSelector: o.LabelSelector,
+		FieldSelector: fieldSelector.String(),
+	}, nil
+}
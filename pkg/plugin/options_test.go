@@ -0,0 +1,67 @@
+package plugin
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListOptions(t *testing.T) {
+
+	tests := map[string]struct {
+		opts              Options
+		wantLabelSelector string
+		wantFieldSelector string
+		wantErr           bool
+	}{
+		"no selectors":    {opts: Options{}},
+		"label selector":  {opts: Options{LabelSelector: "app=checkout"}, wantLabelSelector: "app=checkout"},
+		"field selector":  {opts: Options{FieldSelector: "status.phase=Running"}, wantFieldSelector: "status.phase=Running"},
+		"node":            {opts: Options{NodeName: "node-1"}, wantFieldSelector: "spec.nodeName=node-1"},
+		"node and fields": {opts: Options{NodeName: "node-1", FieldSelector: "status.phase=Running"}, wantFieldSelector: "status.phase=Running,spec.nodeName=node-1"},
+		"invalid label":   {opts: Options{LabelSelector: "app==="}, wantErr: true},
+		"invalid field":   {opts: Options{FieldSelector: "status.phase"}, wantErr: true},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+
+			listOptions, err := tc.opts.ListOptions()
+			if tc.wantErr {
+				assert.NotNil(t, err)
+				return
+			}
+
+			assert.Nil(t, err)
+			assert.Equal(t, tc.wantLabelSelector, listOptions.LabelSelector)
+			assert.Equal(t, tc.wantFieldSelector, listOptions.FieldSelector)
+		})
+	}
+}
+
+func TestOptionsInWindow(t *testing.T) {
+
+	since := time.Date(2023, 1, 2, 0, 0, 0, 0, time.UTC)
+	until := since.Add(12 * time.Hour)
+
+	tests := map[string]struct {
+		opts       Options
+		terminated time.Time
+		want       bool
+	}{
+		"no window":       {opts: Options{}, terminated: since, want: true},
+		"after since":     {opts: Options{Since: since}, terminated: since.Add(time.Hour), want: true},
+		"before since":    {opts: Options{Since: since}, terminated: since.Add(-time.Hour), want: false},
+		"before until":    {opts: Options{Until: until}, terminated: until.Add(-time.Hour), want: true},
+		"after until":     {opts: Options{Until: until}, terminated: until.Add(time.Hour), want: false},
+		"start inclusive": {opts: Options{Since: since, Until: until}, terminated: since, want: true},
+		"end inclusive":   {opts: Options{Since: since, Until: until}, terminated: until, want: true},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.want, tc.opts.inWindow(TerminatedPodInfo{terminatedTime: tc.terminated}))
+		})
+	}
+}
@@ -0,0 +1,220 @@
+package plugin
+
+import (
+	"fmt"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	// APIVersion is the version of the structured output. Fields may be added
+	// within a version, but a breaking change requires a new version.
+	APIVersion = "oomd.jdockerty.dev/v1"
+
+	// TerminationKind is the kind of a single terminated container.
+	TerminationKind = "Termination"
+
+	// TerminationListKind is the kind of a list of terminated containers.
+	TerminationListKind = "TerminationList"
+)
+
+// TerminationList is the versioned representation of TerminatedPods, used
+// for machine readable output such as JSON and YAML.
+type TerminationList struct {
+	metav1.TypeMeta `json:",inline"`
+
+	Items []Termination `json:"items"`
+}
+
+// Termination is the versioned representation of a TerminatedPodInfo.
+type Termination struct {
+	metav1.TypeMeta `json:",inline"`
+
+	Namespace      string              `json:"namespace"`
+	Pod            string              `json:"pod"`
+	PodUID         types.UID           `json:"podUID"`
+	Owner          string              `json:"owner,omitempty"`
+	Container      string              `json:"container"`
+	ContainerType  ContainerType       `json:"containerType"`
+	State          TerminationState    `json:"state"`
+	Category       TerminationCategory `json:"category"`
+	StartTime      metav1.Time         `json:"startTime"`
+	TerminatedTime metav1.Time         `json:"terminatedTime"`
+	Memory         MemoryQuantities    `json:"memory"`
+	Node           string              `json:"node,omitempty"`
+	QOSClass       v1.PodQOSClass      `json:"qosClass,omitempty"`
+	Image          string              `json:"image,omitempty"`
+	RestartCount   int32               `json:"restartCount"`
+	ExitCode       int32               `json:"exitCode"`
+	Signal         int32               `json:"signal,omitempty"`
+	Reason         string              `json:"reason,omitempty"`
+	Message        string              `json:"message,omitempty"`
+}
+
+// MemoryQuantities is the memory request, limit and current usage of a container,
+// along with its peak and growth before it was terminated. Each is omitted when it
+// is not set or unknown.
+type MemoryQuantities struct {
+	Request         *MemoryQuantity `json:"request,omitempty"`
+	Limit           *MemoryQuantity `json:"limit,omitempty"`
+	Usage           *MemoryQuantity `json:"usage,omitempty"`
+	Peak            *MemoryQuantity `json:"peak,omitempty"`
+	GrowthPerMinute *MemoryQuantity `json:"growthPerMinute,omitempty"`
+}
+
+// MemoryQuantity is an amount of memory in both its human readable form, as it
+// appears in the pod specification, and in bytes.
+type MemoryQuantity struct {
+	Quantity string `json:"quantity"`
+	Bytes    int64  `json:"bytes"`
+}
+
+// newMemoryQuantity returns nil for a zero quantity, as this is an unset request or limit.
+func newMemoryQuantity(q resource.Quantity) *MemoryQuantity {
+	if q.IsZero() {
+		return nil
+	}
+
+	return &MemoryQuantity{Quantity: q.String(), Bytes: q.Value()}
+}
+
+// newMeasuredMemoryQuantity returns nil when the memory was not measured, the
+// quantity is displayed as it was rounded but the bytes are exact.
+func newMeasuredMemoryQuantity(display string, q resource.Quantity) *MemoryQuantity {
+	if display == "" {
+		return nil
+	}
+
+	return &MemoryQuantity{Quantity: display, Bytes: q.Value()}
+}
+
+// ToTermination converts the terminated pod information into its versioned representation.
+func (t TerminatedPodInfo) ToTermination() Termination {
+
+	termination := Termination{
+		TypeMeta:       metav1.TypeMeta{APIVersion: APIVersion, Kind: TerminationKind},
+		Namespace:      t.Pod.Namespace,
+		Pod:            t.Pod.Name,
+		PodUID:         t.Pod.UID,
+		Owner:          t.Owner,
+		Container:      t.ContainerName,
+		ContainerType:  t.ContainerType,
+		State:          t.State,
+		Category:       t.Category,
+		StartTime:      metav1.NewTime(t.startTime),
+		TerminatedTime: metav1.NewTime(t.terminatedTime),
+		Memory: MemoryQuantities{
+			Request: newMemoryQuantity(t.Memory.request),
+			Limit:   newMemoryQuantity(t.Memory.limit),
+			Usage:   newMemoryQuantity(t.Memory.usage),
+
+			Peak:            newMeasuredMemoryQuantity(t.Memory.Peak, t.Memory.peak),
+			GrowthPerMinute: newMeasuredMemoryQuantity(t.Memory.GrowthPerMinute, t.Memory.growthPerMinute),
+		},
+		Node:     t.Pod.Spec.NodeName,
+		QOSClass: t.Pod.Status.QOSClass,
+	}
+
+	if status, ok := t.ContainerStatus(); ok {
+		termination.Image = status.Image
+		termination.RestartCount = status.RestartCount
+	}
+
+	if terminated := t.Termination(); terminated != nil {
+		termination.ExitCode = terminated.ExitCode
+		termination.Signal = terminated.Signal
+		termination.Reason = terminated.Reason
+		termination.Message = terminated.Message
+	}
+
+	return termination
+}
+
+// ID uniquely identifies the termination of a container, this stays the same when
+// the termination is seen again, such as by a later run.
+func (t Termination) ID() string {
+	return fmt.Sprintf("%s/%s/%d", t.PodUID, t.Container, t.TerminatedTime.Unix())
+}
+
+// ToList converts the terminated pods into their versioned list representation.
+// The items are always non-nil, so that an empty result is an empty list.
+func (t TerminatedPods) ToList() *TerminationList {
+
+	items := make([]Termination, 0, len(t))
+	for _, p := range t {
+		items = append(items, p.ToTermination())
+	}
+
+	return NewTerminationList(items)
+}
+
+// NewTerminationList returns the versioned list of the terminations, such as
+// those from the history. The items are always non-nil.
+func NewTerminationList(items []Termination) *TerminationList {
+
+	if items == nil {
+		items = []Termination{}
+	}
+
+	return &TerminationList{
+		TypeMeta: metav1.TypeMeta{APIVersion: APIVersion, Kind: TerminationListKind},
+		Items:    items,
+	}
+}
+
+// DeepCopyInto copies the receiver into out, both must be non-nil.
+func (in *MemoryQuantities) DeepCopyInto(out *MemoryQuantities) {
+	*out = *in
+	if in.Request != nil {
+		request := *in.Request
+		out.Request = &request
+	}
+	if in.Limit != nil {
+		limit := *in.Limit
+		out.Limit = &limit
+	}
+	if in.Usage != nil {
+		usage := *in.Usage
+		out.Usage = &usage
+	}
+	if in.Peak != nil {
+		peak := *in.Peak
+		out.Peak = &peak
+	}
+	if in.GrowthPerMinute != nil {
+		growth := *in.GrowthPerMinute
+		out.GrowthPerMinute = &growth
+	}
+}
+
+// DeepCopyInto copies the receiver into out, both must be non-nil.
+func (in *Termination) DeepCopyInto(out *Termination) {
+	*out = *in
+	in.StartTime.DeepCopyInto(&out.StartTime)
+	in.TerminatedTime.DeepCopyInto(&out.TerminatedTime)
+	in.Memory.DeepCopyInto(&out.Memory)
+}
+
+// DeepCopyObject implements runtime.Object.
+func (in *Termination) DeepCopyObject() runtime.Object {
+	out := new(Termination)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject implements runtime.Object.
+func (in *TerminationList) DeepCopyObject() runtime.Object {
+	out := new(TerminationList)
+	out.TypeMeta = in.TypeMeta
+	if in.Items != nil {
+		out.Items = make([]Termination, len(in.Items))
+		for i := range in.Items {
+			in.Items[i].DeepCopyInto(&out.Items[i])
+		}
+	}
+	return out
+}
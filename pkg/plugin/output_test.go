@@ -0,0 +1,65 @@
+package plugin
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/cli-runtime/pkg/printers"
+)
+
+func TestToList(t *testing.T) {
+
+	terminated := time.Date(2022, 11, 7, 13, 3, 49, 0, time.UTC)
+
+	pods := TerminatedPods{
+		TerminatedPodInfo{
+			Pod:            v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "my-app", Namespace: "oomkilled", UID: "1234"}},
+			ContainerName:  "infoapp",
+			ContainerType:  ContainerTypeRegular,
+			State:          TerminationStateLast,
+			Category:       CategoryOOMKilled,
+			Memory:         MemoryInfo{limit: resource.MustParse("128Mi")},
+			startTime:      terminated.Add(-time.Minute),
+			terminatedTime: terminated,
+		},
+	}
+
+	list := pods.ToList()
+	assert.Equal(t, APIVersion, list.APIVersion)
+	assert.Equal(t, TerminationListKind, list.Kind)
+	assert.Equal(t, 1, len(list.Items))
+
+	var buf bytes.Buffer
+	err := (&printers.JSONPrinter{}).PrintObj(list, &buf)
+	assert.Nil(t, err)
+
+	var decoded map[string]interface{}
+	assert.Nil(t, json.Unmarshal(buf.Bytes(), &decoded))
+
+	item := decoded["items"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, "my-app", item["pod"])
+	assert.Equal(t, "oomkilled", item["namespace"])
+	assert.Equal(t, "1234", item["podUID"])
+	assert.Equal(t, "2022-11-07T13:03:49Z", item["terminatedTime"])
+
+	memory := item["memory"].(map[string]interface{})
+	assert.Nil(t, memory["request"], "unset request should be omitted")
+	assert.Equal(t, "128Mi", memory["limit"].(map[string]interface{})["quantity"])
+	assert.Equal(t, float64(128*1024*1024), memory["limit"].(map[string]interface{})["bytes"])
+}
+
+func TestToListEmpty(t *testing.T) {
+
+	var buf bytes.Buffer
+	err := (&printers.YAMLPrinter{}).PrintObj(TerminatedPods{}.ToList(), &buf)
+	assert.Nil(t, err)
+
+	assert.Contains(t, buf.String(), "items: []")
+	assert.Contains(t, buf.String(), "kind: TerminationList")
+}
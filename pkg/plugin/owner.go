@@ -0,0 +1,313 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/metadata"
+	"k8s.io/client-go/tools/pager"
+)
+
+// podOwner returns the Deployment which owns the pod from the name of its
+// ReplicaSet as `Kind/Name`, or the controller itself, which is an empty string
+// for pods without a controller.
+//
+// Pods created by a Deployment are owned by a ReplicaSet, whose name changes on
+// every rollout. The Deployment is found by trimming the `pod-template-hash` from
+// the ReplicaSet's name, this is only used when the ReplicaSet no longer exists.
+func podOwner(pod v1.Pod) string {
+
+	ref := metav1.GetControllerOf(&pod)
+	if ref == nil {
+		return ""
+	}
+
+	if ref.Kind == "ReplicaSet" {
+		hash := pod.Labels[appsv1.DefaultDeploymentUniqueLabelKey]
+		if hash != "" && strings.HasSuffix(ref.Name, "-"+hash) {
+			return "Deployment/" + strings.TrimSuffix(ref.Name, "-"+hash)
+		}
+	}
+
+	return ref.Kind + "/" + ref.Name
+}
+
+// workloadKey identifies a top-level workload, such as a Deployment, or a pod
+// without a controller.
+type workloadKey struct {
+	namespace, kind, name string
+}
+
+// String returns the workload as `Kind/Name`.
+func (k workloadKey) String() string {
+	return k.kind + "/" + k.name
+}
+
+// workload returns the owner of the pod, or the pod itself as `Pod/Name` when it
+// does not have one, so that every pod belongs to a workload.
+func (t TerminatedPodInfo) workload() string {
+
+	if t.Owner != "" {
+		return t.Owner
+	}
+
+	return "Pod/" + t.Pod.Name
+}
+
+// workload returns the owner of the terminated pod, or the pod itself as `Pod/Name`
+// when it does not have one.
+func (t Termination) workload() string {
+
+	if t.Owner != "" {
+		return t.Owner
+	}
+
+	return "Pod/" + t.Pod
+}
+
+// resolveOwners sets the owner of each terminated pod to its top-level controller.
+func resolveOwners(ctx context.Context, owners *OwnerResolver, pods TerminatedPods) error {
+
+	for i := range pods {
+		owner, err := owners.owner(ctx, pods[i].Pod)
+		if err != nil {
+			return err
+		}
+		pods[i].Owner = owner
+	}
+
+	return nil
+}
+
+// maxOwnerDepth bounds the chain of owners which is followed, in case of a cycle
+// of ownerReferences.
+const maxOwnerDepth = 10
+
+// objectKey identifies an object from an ownerReference, cluster-scoped objects
+// have an empty namespace.
+type objectKey struct {
+	namespace, group, kind, name string
+}
+
+// listKey identifies the objects of a resource in a namespace.
+type listKey struct {
+	namespace string
+	resource  schema.GroupVersionResource
+}
+
+// OwnerResolver walks the ownerReferences of pods to their top-level controller,
+// using discovery to find the resource of each owner so that custom controllers,
+// such as an Argo Rollout, are followed in the same way as a Deployment.
+//
+// Rather than retrieving each owner, the metadata of every object of its resource is
+// listed from the namespace once and the controllers are cached, so the pods of a
+// namespace resolve in a single list for each kind of owner. An owner which was not
+// listed, such as the Job of a CronJob which was created during a watch, is then
+// retrieved on its own.
+//
+// An OwnerResolver must not be used concurrently.
+type OwnerResolver struct {
+	client metadata.Interface
+	mapper meta.RESTMapper
+
+	// controllers is the controller of each listed object, which is nil for a
+	// top-level object.
+	controllers map[objectKey]*metav1.OwnerReference
+	listed      map[listKey]bool
+
+	// resolved is the top-level controller of each controller of a pod.
+	resolved map[objectKey]workloadKey
+}
+
+// NewOwnerResolver returns an OwnerResolver which uses the metadata client and
+// REST mapper of the factory.
+func NewOwnerResolver(factory ClientFactory) (*OwnerResolver, error) {
+
+	client, err := factory.MetadataClient()
+	if err != nil {
+		return nil, err
+	}
+
+	mapper, err := factory.ToRESTMapper()
+	if err != nil {
+		return nil, fmt.Errorf("unable to discover the resources of the cluster: %w", err)
+	}
+
+	return newOwnerResolver(client, mapper), nil
+}
+
+func newOwnerResolver(client metadata.Interface, mapper meta.RESTMapper) *OwnerResolver {
+	return &OwnerResolver{
+		client:      client,
+		mapper:      mapper,
+		controllers: make(map[objectKey]*metav1.OwnerReference),
+		listed:      make(map[listKey]bool),
+		resolved:    make(map[objectKey]workloadKey),
+	}
+}
+
+// resolve returns the top-level controller of the pod, or the pod itself when it
+// does not have a controller. The chain of owners stops at an object which cannot
+// be found or listed, such as one which has been deleted or whose CRD is no longer
+// installed, and that object is used as the top-level controller.
+func (r *OwnerResolver) resolve(ctx context.Context, pod v1.Pod) (workloadKey, error) {
+
+	ref := metav1.GetControllerOf(&pod)
+	if ref == nil {
+		return workloadKey{pod.Namespace, "Pod", pod.Name}, nil
+	}
+
+	refKey := newObjectKey(pod.Namespace, *ref)
+	if key, ok := r.resolved[refKey]; ok {
+		return key, nil
+	}
+
+	current, namespace := *ref, pod.Namespace
+
+	for depth := 0; depth < maxOwnerDepth; depth++ {
+
+		owner, found, err := r.controllerOf(ctx, &namespace, current)
+		if err != nil {
+			return workloadKey{}, fmt.Errorf("unable to retrieve the owner of %s: %w", pod.Name, err)
+		}
+
+		// The ReplicaSet of an old rollout may have been deleted, so the
+		// Deployment is found from the name of the ReplicaSet instead.
+		if !found && depth == 0 && current.Kind == "ReplicaSet" {
+			kind, name, _ := strings.Cut(podOwner(pod), "/")
+			current = metav1.OwnerReference{Kind: kind, Name: name}
+		}
+
+		if !found || owner == nil {
+			break
+		}
+		current = *owner
+	}
+
+	key := workloadKey{pod.Namespace, current.Kind, current.Name}
+	r.resolved[refKey] = key
+
+	return key, nil
+}
+
+// owner returns the top-level controller of the pod as `Kind/Name`, or an empty
+// string when it does not have a controller.
+func (r *OwnerResolver) owner(ctx context.Context, pod v1.Pod) (string, error) {
+
+	if metav1.GetControllerOf(&pod) == nil {
+		return "", nil
+	}
+
+	key, err := r.resolve(ctx, pod)
+	if err != nil {
+		return "", err
+	}
+
+	return key.String(), nil
+}
+
+// controllerOf returns the controller of the referenced object in the namespace,
+// which is nil when it does not have one, and whether the object was found. The
+// namespace is cleared when the object is cluster-scoped, so that its own owner
+// is also looked up as a cluster-scoped object.
+func (r *OwnerResolver) controllerOf(ctx context.Context, namespace *string, ref metav1.OwnerReference) (*metav1.OwnerReference, bool, error) {
+
+	gv, err := schema.ParseGroupVersion(ref.APIVersion)
+	if err != nil {
+		return nil, false, nil
+	}
+
+	mapping, err := r.mapper.RESTMapping(schema.GroupKind{Group: gv.Group, Kind: ref.Kind}, gv.Version)
+	if meta.IsNoMatchError(err) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	if mapping.Scope.Name() == meta.RESTScopeNameRoot {
+		*namespace = ""
+	}
+
+	list := listKey{*namespace, mapping.Resource}
+	if !r.listed[list] {
+		if err := r.list(ctx, list, gv.Group, ref.Kind); err != nil {
+			return nil, false, err
+		}
+	}
+
+	key := objectKey{*namespace, gv.Group, ref.Kind, ref.Name}
+	if owner, found := r.controllers[key]; found {
+		return owner, true, nil
+	}
+
+	return r.get(ctx, list, key)
+}
+
+// list caches the controller of every object of the resource in the namespace.
+// Objects which cannot be listed are treated as though they do not exist.
+func (r *OwnerResolver) list(ctx context.Context, list listKey, group, kind string) error {
+
+	p := pager.New(func(ctx context.Context, opts metav1.ListOptions) (runtime.Object, error) {
+		return r.client.Resource(list.resource).Namespace(list.namespace).List(ctx, opts)
+	})
+	p.PageSize = DefaultChunkSize
+
+	err := p.EachListItem(ctx, metav1.ListOptions{}, func(obj runtime.Object) error {
+		m, ok := obj.(*metav1.PartialObjectMetadata)
+		if !ok {
+			return fmt.Errorf("unexpected object type %T", obj)
+		}
+		r.controllers[objectKey{list.namespace, group, kind, m.Name}] = controllerRef(m.OwnerReferences)
+		return nil
+	})
+	if err != nil && !apierrors.IsForbidden(err) && !apierrors.IsNotFound(err) {
+		return fmt.Errorf("unable to list %s: %w", list.resource.Resource, err)
+	}
+
+	r.listed[list] = true
+	return nil
+}
+
+// get caches the controller of an object which was not listed, returning whether
+// it was found. Objects which cannot be retrieved are treated as though they do
+// not exist.
+func (r *OwnerResolver) get(ctx context.Context, list listKey, key objectKey) (*metav1.OwnerReference, bool, error) {
+
+	m, err := r.client.Resource(list.resource).Namespace(list.namespace).Get(ctx, key.name, metav1.GetOptions{})
+	if apierrors.IsForbidden(err) || apierrors.IsNotFound(err) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("unable to get %s %s: %w", list.resource.Resource, key.name, err)
+	}
+
+	owner := controllerRef(m.OwnerReferences)
+	r.controllers[key] = owner
+
+	return owner, true, nil
+}
+
+// newObjectKey returns the key of the object referenced from the namespace.
+func newObjectKey(namespace string, ref metav1.OwnerReference) objectKey {
+	gv, _ := schema.ParseGroupVersion(ref.APIVersion)
+	return objectKey{namespace, gv.Group, ref.Kind, ref.Name}
+}
+
+// controllerRef returns the reference which is the controller, or nil.
+func controllerRef(refs []metav1.OwnerReference) *metav1.OwnerReference {
+	for i := range refs {
+		if refs[i].Controller != nil && *refs[i].Controller {
+			return &refs[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,192 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/jdockerty/kubectl-oomd/internal/testutil"
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/meta/testrestmapper"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	metadatafake "k8s.io/client-go/metadata/fake"
+	"k8s.io/kubectl/pkg/scheme"
+)
+
+var (
+	// The custom controllers which the test REST mapper knows about.
+	rolloutKind        = schema.GroupVersionKind{Group: "argoproj.io", Version: "v1alpha1", Kind: "Rollout"}
+	virtualMachineKind = schema.GroupVersionKind{Group: "kubevirt.io", Version: "v1", Kind: "VirtualMachine"}
+	vmInstanceKind     = schema.GroupVersionKind{Group: "kubevirt.io", Version: "v1", Kind: "VirtualMachineInstance"}
+)
+
+// testOwnerResolver returns an OwnerResolver over a fake metadata client which
+// contains the objects, knowing about the built-in resources and the custom
+// controllers above.
+func testOwnerResolver(objects ...runtime.Object) *OwnerResolver {
+	resolver, _ := testOwnerResolverClient(objects...)
+	return resolver
+}
+
+// testOwnerResolverClient also returns the fake metadata client, so that the API
+// calls can be checked.
+func testOwnerResolverClient(objects ...runtime.Object) (*OwnerResolver, *metadatafake.FakeMetadataClient) {
+
+	custom := meta.NewDefaultRESTMapper(nil)
+	for _, gvk := range []schema.GroupVersionKind{rolloutKind, virtualMachineKind, vmInstanceKind} {
+		custom.Add(gvk, meta.RESTScopeNamespace)
+	}
+
+	client := testutil.MetadataClient(objects...)
+	mapper := meta.MultiRESTMapper{testrestmapper.TestOnlyStaticRESTMapper(scheme.Scheme), custom}
+
+	return newOwnerResolver(client, mapper), client
+}
+
+// customObject returns a custom resource in the shop namespace, owned by the
+// given controller when it is not nil.
+func customObject(gvk schema.GroupVersionKind, name string, owner *metav1.OwnerReference) *unstructured.Unstructured {
+
+	u := &unstructured.Unstructured{}
+	u.SetGroupVersionKind(gvk)
+	u.SetNamespace("shop")
+	u.SetName(name)
+
+	if owner != nil {
+		u.SetOwnerReferences([]metav1.OwnerReference{*owner})
+	}
+
+	return u
+}
+
+// controllerOf returns a controller reference to an object of the kind.
+func controllerOf(gvk schema.GroupVersionKind, name string) *metav1.OwnerReference {
+	controller := true
+	return &metav1.OwnerReference{APIVersion: gvk.GroupVersion().String(), Kind: gvk.Kind, Name: name, Controller: &controller}
+}
+
+func TestPodOwner(t *testing.T) {
+
+	controller := true
+	pod := func(kind, name string, labels map[string]string) v1.Pod {
+		p := v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "checkout-1", Labels: labels}}
+		if kind != "" {
+			p.OwnerReferences = []metav1.OwnerReference{{Kind: kind, Name: name, Controller: &controller}}
+		}
+		return p
+	}
+
+	tests := map[string]struct {
+		pod  v1.Pod
+		want string
+	}{
+		"no owner": {
+			pod:  pod("", "", nil),
+			want: "",
+		},
+		"deployment": {
+			pod:  pod("ReplicaSet", "checkout-5bcbcdf97", map[string]string{"pod-template-hash": "5bcbcdf97"}),
+			want: "Deployment/checkout",
+		},
+		"replicaset without a deployment": {
+			pod:  pod("ReplicaSet", "checkout", nil),
+			want: "ReplicaSet/checkout",
+		},
+		"statefulset": {
+			pod:  pod("StatefulSet", "kafka", map[string]string{"controller-revision-hash": "kafka-7d9f8"}),
+			want: "StatefulSet/kafka",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.want, podOwner(tc.pod))
+		})
+	}
+}
+
+func TestOwnerResolver(t *testing.T) {
+
+	replicaSetKind := appsv1.SchemeGroupVersion.WithKind("ReplicaSet")
+
+	objects := []runtime.Object{
+		&appsv1.ReplicaSet{ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "checkout-5bcbcdf97", OwnerReferences: []metav1.OwnerReference{*controllerOf(rolloutKind, "checkout")}}},
+		customObject(rolloutKind, "checkout", nil),
+		customObject(vmInstanceKind, "database", controllerOf(virtualMachineKind, "database")),
+		customObject(virtualMachineKind, "database", nil),
+	}
+
+	pod := func(owner *metav1.OwnerReference, labels map[string]string) v1.Pod {
+		p := testutil.Pod("shop", "pod", 137, "OOMKilled")
+		p.Labels = labels
+		if owner != nil {
+			p.OwnerReferences = []metav1.OwnerReference{*owner}
+		}
+		return *p
+	}
+
+	tests := map[string]struct {
+		pod  v1.Pod
+		want string
+	}{
+		"argo rollout": {
+			pod:  pod(controllerOf(replicaSetKind, "checkout-5bcbcdf97"), nil),
+			want: "Rollout/checkout",
+		},
+		"kubevirt launcher": {
+			pod:  pod(controllerOf(vmInstanceKind, "database"), nil),
+			want: "VirtualMachine/database",
+		},
+		"no controller": {
+			pod:  pod(nil, nil),
+			want: "Pod/pod",
+		},
+		"deleted replicaset": {
+			pod:  pod(controllerOf(replicaSetKind, "payments-7d9c6b5f4"), map[string]string{appsv1.DefaultDeploymentUniqueLabelKey: "7d9c6b5f4"}),
+			want: "Deployment/payments",
+		},
+		"custom resource which is not installed": {
+			pod:  pod(controllerOf(schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "Widget"}, "widget"), nil),
+			want: "Widget/widget",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			key, err := testOwnerResolver(objects...).resolve(context.Background(), tc.pod)
+			assert.Nil(t, err)
+			assert.Equal(t, tc.want, key.String())
+		})
+	}
+}
+
+func TestOwnerResolverCaching(t *testing.T) {
+
+	replicaSetKind := appsv1.SchemeGroupVersion.WithKind("ReplicaSet")
+
+	objects := []runtime.Object{customObject(rolloutKind, "checkout", nil)}
+	for i := 0; i < 10; i++ {
+		name := fmt.Sprintf("checkout-%d", i)
+		objects = append(objects, &appsv1.ReplicaSet{ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: name, OwnerReferences: []metav1.OwnerReference{*controllerOf(rolloutKind, "checkout")}}})
+	}
+
+	resolver, client := testOwnerResolverClient(objects...)
+
+	for i := 0; i < 1000; i++ {
+		pod := testutil.Pod("shop", fmt.Sprintf("checkout-%d", i), 137, "OOMKilled")
+		pod.OwnerReferences = []metav1.OwnerReference{*controllerOf(replicaSetKind, fmt.Sprintf("checkout-%d", i%10))}
+
+		key, err := resolver.resolve(context.Background(), *pod)
+		assert.Nil(t, err)
+		assert.Equal(t, "Rollout/checkout", key.String())
+	}
+
+	// A single list of the ReplicaSets and the Rollouts.
+	assert.Equal(t, 2, len(client.Actions()))
+}
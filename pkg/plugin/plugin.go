@@ -1,13 +1,14 @@
 package plugin
 
 import (
+	"context"
 	"fmt"
-	"sort"
 	"time"
 
-	"golang.org/x/net/context"
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/cli-runtime/pkg/genericclioptions"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
@@ -20,28 +21,164 @@ type TerminatedPods []TerminatedPodInfo
 // words, it shows the first OOMKilled pod found at the top of the table and the
 // most recent one at the end.
 func (t TerminatedPods) SortByTimestamp() {
-	sort.Slice(t, func(i, j int) bool {
-		return t[i].terminatedTime.Before(t[j].terminatedTime)
-	})
+	t.SortBy([]SortField{SortFieldTime}, false)
 }
 
 // TerminatedPodInfo is a wrapper struct around an OOMKilled Pod's information.
 type TerminatedPodInfo struct {
 	Pod            v1.Pod
+	Owner          string // Top-level workload which owns the pod as `Kind/Name`, empty for pods without a controller.
 	Memory         MemoryInfo
-	ContainerName  string // Name of the container within the pod that was terminated, in the case of multi-container pods.
-	TerminatedTime string // When the pod was terminated
-	StartTime      string // When the pod was started during the termination period.
-
-	// Internal representation of TerminatedTime, used for operations which require
-	// the explicit time.Time type, such as sorting.
+	ContainerName  string              // Name of the container within the pod that was terminated, in the case of multi-container pods.
+	ContainerType  ContainerType       // Whether the container is a regular, init or ephemeral container.
+	State          TerminationState    // Whether the termination is the container's current or last state.
+	Category       TerminationCategory // Why the container was terminated, e.g. OOMKilled or SIGKILL.
+	TerminatedTime string              // When the pod was terminated
+	StartTime      string              // When the pod was started during the termination period.
+
+	// Internal representation of TerminatedTime and StartTime, used for operations which
+	// require the explicit time.Time type, such as sorting.
 	terminatedTime time.Time
+	startTime      time.Time
+}
+
+// ContainerStatus returns the status of the terminated container from the pod,
+// the status is looked up by both the container type and its name.
+func (t TerminatedPodInfo) ContainerStatus() (v1.ContainerStatus, bool) {
+	for _, s := range podContainerStatuses(t.Pod) {
+		if s.containerType == t.ContainerType && s.status.Name == t.ContainerName {
+			return s.status, true
+		}
+	}
+	return v1.ContainerStatus{}, false
+}
+
+// Termination returns the terminated state of the container which was reported,
+// this is nil when the container status is no longer available within the pod.
+func (t TerminatedPodInfo) Termination() *v1.ContainerStateTerminated {
+
+	status, ok := t.ContainerStatus()
+	if !ok {
+		return nil
+	}
+
+	if t.State == TerminationStateCurrent {
+		return status.State.Terminated
+	}
+	return status.LastTerminationState.Terminated
+}
+
+// RunDuration is how long the container ran for before it was terminated. This
+// is zero when the start time was not recorded by the container runtime.
+func (t TerminatedPodInfo) RunDuration() time.Duration {
+	if t.startTime.IsZero() || t.terminatedTime.IsZero() {
+		return 0
+	}
+	return t.terminatedTime.Sub(t.startTime)
+}
+
+// TerminationState indicates which state of the container a termination was read from.
+type TerminationState string
+
+const (
+	// TerminationStateCurrent is a container which is currently terminated, this is
+	// common for Job pods or those with a `restartPolicy` of `Never`, as the container
+	// is not restarted after it has been killed.
+	TerminationStateCurrent TerminationState = "Current"
+
+	// TerminationStateLast is the last termination of a container which has since restarted.
+	TerminationStateLast TerminationState = "Last"
+)
+
+// ContainerType is the kind of container within the pod specification.
+type ContainerType string
+
+const (
+	// ContainerTypeRegular is a container from the `containers` list of the pod.
+	ContainerTypeRegular ContainerType = "Container"
+
+	// ContainerTypeInit is a container from the `initContainers` list of the pod,
+	// this includes native sidecars which are declared as restartable init containers.
+	ContainerTypeInit ContainerType = "Init"
+
+	// ContainerTypeEphemeral is an ephemeral container, such as one added by `kubectl debug`.
+	ContainerTypeEphemeral ContainerType = "Ephemeral"
+)
+
+// podContainerStatus is the status of a container within a pod alongside its type.
+type podContainerStatus struct {
+	containerType ContainerType
+	status        v1.ContainerStatus
+}
+
+// podContainerStatuses returns the statuses of every container within the pod,
+// the init containers are first, followed by regular and then ephemeral containers.
+func podContainerStatuses(pod v1.Pod) []podContainerStatus {
+
+	var statuses []podContainerStatus
+
+	for _, status := range pod.Status.InitContainerStatuses {
+		statuses = append(statuses, podContainerStatus{containerType: ContainerTypeInit, status: status})
+	}
+
+	for _, status := range pod.Status.ContainerStatuses {
+		statuses = append(statuses, podContainerStatus{containerType: ContainerTypeRegular, status: status})
+	}
+
+	for _, status := range pod.Status.EphemeralContainerStatuses {
+		statuses = append(statuses, podContainerStatus{containerType: ContainerTypeEphemeral, status: status})
+	}
+
+	return statuses
+}
+
+// containerTermination is a terminated state of a container alongside which
+// state it was read from.
+type containerTermination struct {
+	state      TerminationState
+	terminated *v1.ContainerStateTerminated
+}
+
+// containerTerminations returns both the current and last terminated states of
+// a container, either may be nil when the container was not terminated, in which
+// case it is omitted.
+func containerTerminations(status v1.ContainerStatus) []containerTermination {
+
+	var terminations []containerTermination
+
+	if terminated := status.State.Terminated; terminated != nil {
+		terminations = append(terminations, containerTermination{state: TerminationStateCurrent, terminated: terminated})
+	}
+
+	if terminated := status.LastTerminationState.Terminated; terminated != nil {
+		terminations = append(terminations, containerTermination{state: TerminationStateLast, terminated: terminated})
+	}
+
+	return terminations
 }
 
 // MemoryInfo is the container resource requests, specific to the memory limit and requests.
 type MemoryInfo struct {
 	Request string
 	Limit   string
+
+	// Usage is the current working set of the container, from the metrics API.
+	// This is empty when it is unknown, such as when metrics-server is not installed.
+	Usage string
+
+	// Peak is the highest memory of the container before it was terminated and
+	// GrowthPerMinute is how quickly it grew, both from Prometheus. These are
+	// empty when they are unknown, such as when Prometheus is not configured.
+	Peak            string
+	GrowthPerMinute string
+
+	// Internal representation of Request, Limit, Usage, Peak and GrowthPerMinute,
+	// used for operations which require the explicit quantity, such as conversion to bytes.
+	request         resource.Quantity
+	limit           resource.Quantity
+	usage           resource.Quantity
+	peak            resource.Quantity
+	growthPerMinute resource.Quantity
 }
 
 func getK8sClientAndConfig(configFlags *genericclioptions.ConfigFlags) (*kubernetes.Clientset, *rest.Config, error) {
@@ -59,25 +196,41 @@ func getK8sClientAndConfig(configFlags *genericclioptions.ConfigFlags) (*kuberne
 	return clientset, config, nil
 }
 
-// getPodSpecIndex is a helper function to return the index of a container
-// within the containers list of the pod specification. This is used as the
-// index, as the index which appears within the containerStatus field is not
-// guaranteed to be the same.
-func getPodSpecIndex(name string, pod v1.Pod) (int, error) {
-
-	for i, c := range pod.Spec.Containers {
-		if name == c.Name {
-			return i, nil
+// getContainerResources is a helper function to return the resources of a container
+// from the pod specification. The container is looked up by name within the list
+// matching its type, as the index which appears within the containerStatus field
+// is not guaranteed to be the same.
+func getContainerResources(name string, containerType ContainerType, pod v1.Pod) (v1.ResourceRequirements, error) {
+
+	switch containerType {
+	case ContainerTypeInit:
+		for _, c := range pod.Spec.InitContainers {
+			if name == c.Name {
+				return c.Resources, nil
+			}
+		}
+	case ContainerTypeEphemeral:
+		for _, c := range pod.Spec.EphemeralContainers {
+			if name == c.Name {
+				return c.Resources, nil
+			}
+		}
+	default:
+		for _, c := range pod.Spec.Containers {
+			if name == c.Name {
+				return c.Resources, nil
+			}
 		}
 	}
-	return -1, fmt.Errorf("unable to retrieve pod spec index for %s", name)
+	return v1.ResourceRequirements{}, fmt.Errorf("unable to retrieve pod spec for %s container %s", containerType, name)
 }
 
 // GetNamespace will retrieve the current namespace from either:
+//
 //	All namespaces when the boolean is set.
 //	The provided namespace by the caller
 //	Current namespace in use from the kubeconfig file
-func GetNamespace(configFlags *genericclioptions.ConfigFlags, all bool, givenNamespace string) (string, error) {
+func GetNamespace(configFlags genericclioptions.RESTClientGetter, all bool, givenNamespace string) (string, error) {
 
 	if all {
 		return metav1.NamespaceAll, nil
@@ -96,71 +249,144 @@ func GetNamespace(configFlags *genericclioptions.ConfigFlags, all bool, givenNam
 	return currentNamespace, nil
 }
 
-// TerminatedPodsFilter is used to filter for pods that contain a terminated container, with an exit code of 137 (OOMKilled).
-func TerminatedPodsFilter(pods []v1.Pod) []v1.Pod {
+// TerminatedContainer identifies a single termination of a container within a
+// pod which the classifier reported as an out of memory kill.
+type TerminatedContainer struct {
+	Pod           v1.Pod
+	ContainerName string
+	ContainerType ContainerType
+	State         TerminationState
+	Category      TerminationCategory
+	Terminated    v1.ContainerStateTerminated
+}
+
+// TerminatedPodsFilter is used to filter for containers which have a termination
+// that the classifier reports as an out of memory kill. Each termination appears
+// exactly once, so a pod with multiple killed containers produces multiple results
+// and containers which were not killed, such as sidecars, are omitted.
+func TerminatedPodsFilter(pods []v1.Pod, classifier TerminationClassifier) []TerminatedContainer {
 
-	var terminatedPods []v1.Pod
+	var terminatedContainers []TerminatedContainer
 
 	for _, pod := range pods {
-		for _, containerStatus := range pod.Status.ContainerStatuses {
+		for _, containerStatus := range podContainerStatuses(pod) {
 
-			// The terminated state may be nil, i.e. not terminated, we must check this first.
-			if terminated := containerStatus.LastTerminationState.Terminated; terminated != nil {
-				if terminated.ExitCode == 137 {
-					terminatedPods = append(terminatedPods, pod)
+			// Not every container within the pod will be in a terminated state, these
+			// have no terminations and are skipped.
+			for _, termination := range containerTerminations(containerStatus.status) {
+
+				category, report := classifier.Classify(termination.terminated)
+				if !report {
+					continue
 				}
+
+				terminatedContainers = append(terminatedContainers, TerminatedContainer{
+					Pod:           pod,
+					ContainerName: containerStatus.status.Name,
+					ContainerType: containerStatus.containerType,
+					State:         termination.state,
+					Category:      category,
+					Terminated:    *termination.terminated,
+				})
 			}
 		}
 	}
 
-	return terminatedPods
+	return terminatedContainers
+}
+
+// buildTerminatedPodsInfo converts the terminated containers of the given pods
+// into the informational struct, including the memory resources of each container.
+func buildTerminatedPodsInfo(pods []v1.Pod, classifier TerminationClassifier) (TerminatedPods, error) {
+
+	var terminatedPodsInfo []TerminatedPodInfo
+
+	for _, container := range TerminatedPodsFilter(pods, classifier) {
+
+		resources, err := getContainerResources(container.ContainerName, container.ContainerType, container.Pod)
+		if err != nil {
+			return nil, err
+		}
+
+		// Build our terminated pod info struct
+		info := TerminatedPodInfo{
+			Pod:            container.Pod,
+			ContainerName:  container.ContainerName,
+			ContainerType:  container.ContainerType,
+			State:          container.State,
+			Category:       container.Category,
+			StartTime:      container.Terminated.StartedAt.String(),
+			startTime:      container.Terminated.StartedAt.Time,
+			terminatedTime: container.Terminated.FinishedAt.Time,
+			TerminatedTime: container.Terminated.FinishedAt.String(),
+			Memory: MemoryInfo{
+				Limit:   resources.Limits.Memory().String(),
+				Request: resources.Requests.Memory().String(),
+				limit:   *resources.Limits.Memory(),
+				request: *resources.Requests.Memory(),
+			},
+		}
+		terminatedPodsInfo = append(terminatedPodsInfo, info)
+	}
+
+	return terminatedPodsInfo, nil
 }
 
 // BuildTerminatedPodsInfo retrieves the terminated pod information, bundled into a slice of the informational struct.
-func BuildTerminatedPodsInfo(client *kubernetes.Clientset, namespace string) (TerminatedPods, error) {
+func BuildTerminatedPodsInfo(ctx context.Context, client kubernetes.Interface, opts Options) (TerminatedPods, error) {
 
-	pods, err := client.CoreV1().Pods(namespace).List(context.Background(), metav1.ListOptions{})
+	listOptions, err := opts.ListOptions()
 	if err != nil {
-		return nil, fmt.Errorf("failed to list pods: %w", err)
+		return nil, err
 	}
 
-	var terminatedPodsInfo []TerminatedPodInfo
+	classifier := opts.classifier()
 
-	terminatedPods := TerminatedPodsFilter(pods.Items)
+	// A pod may be seen more than once, either because it belongs to multiple targets,
+	// e.g. a Deployment and its ReplicaSet, or because the list was restarted. Only
+	// pods which were terminated are tracked, keeping memory bounded by the result.
+	var terminatedPodsInfo TerminatedPods
+	seen := make(map[types.UID]bool)
 
-	for _, pod := range terminatedPods {
-		for _, containerStatus := range pod.Status.ContainerStatuses {
+	collect := func(pods []v1.Pod) error {
 
-			// Not every container within the pod will be in a terminated state, we skip these ones.
-			// This also means we can use the relevant index to directly access the container,
-			// as we know its index within the container status list.
-			if containerStatus.LastTerminationState.Terminated == nil {
-				continue
+		var unseen []v1.Pod
+		for _, pod := range pods {
+			if !seen[pod.UID] {
+				unseen = append(unseen, pod)
 			}
+		}
+
+		info, err := buildTerminatedPodsInfo(unseen, classifier)
+		if err != nil {
+			return err
+		}
 
-			containerStartTime := containerStatus.LastTerminationState.Terminated.StartedAt.String()
-			containerTerminatedTime := containerStatus.LastTerminationState.Terminated.FinishedAt
+		for _, p := range info {
+			seen[p.Pod.UID] = true
 
-			podSpecIndex, err := getPodSpecIndex(containerStatus.Name, pod)
-			if err != nil {
-				return nil, err
+			if opts.inWindow(p) {
+				terminatedPodsInfo = append(terminatedPodsInfo, p)
 			}
+		}
 
-			// Build our terminated pod info struct
-			info := TerminatedPodInfo{
-				Pod:            pod,
-				ContainerName:  containerStatus.Name,
-				StartTime:      containerStartTime,
-				terminatedTime: containerTerminatedTime.Time,
-				TerminatedTime: containerTerminatedTime.String(),
-				Memory: MemoryInfo{
-					Limit:   pod.Spec.Containers[podSpecIndex].Resources.Limits.Memory().String(),
-					Request: pod.Spec.Containers[podSpecIndex].Resources.Requests.Memory().String(),
-				},
-			}
-			// TODO: Since we know all pods here have been in the "terminated state", can we
-			// achieve this same result in an elegant way?
-			terminatedPodsInfo = append(terminatedPodsInfo, info)
+		return nil
+	}
+
+	// Without any targets, every pod matching the options is used.
+	if len(opts.Targets) == 0 {
+		err := listPodPages(ctx, client.CoreV1().Pods(opts.Namespace), listOptions, opts.ChunkSize, opts.RequestTimeout, collect)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list pods: %w", err)
+		}
+
+		return terminatedPodsInfo, nil
+	}
+
+	for _, target := range opts.Targets {
+		err := listPodPages(ctx, client.CoreV1().Pods(target.Namespace), target.listOptions(listOptions), opts.ChunkSize, opts.RequestTimeout, collect)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list pods for %s: %w", target.Name, err)
 		}
 	}
 
@@ -168,17 +394,39 @@ func BuildTerminatedPodsInfo(client *kubernetes.Clientset, namespace string) (Te
 }
 
 // Run returns the pod information for those that have been OOMKilled, this provides the plugin functionality.
-func Run(configFlags *genericclioptions.ConfigFlags, namespace string) (TerminatedPods, error) {
+// Cancelling the context stops any in-flight API calls.
+func Run(ctx context.Context, factory ClientFactory, opts Options) (TerminatedPods, error) {
 
-	clientset, _, err := getK8sClientAndConfig(configFlags)
+	clientset, err := factory.KubernetesClient()
 	if err != nil {
-		return nil, fmt.Errorf("unable to get Kubernetes client and config: %s", err)
+		return nil, fmt.Errorf("unable to get Kubernetes client and config: %w", err)
 	}
 
-	terminatedPods, err := BuildTerminatedPodsInfo(clientset, namespace)
+	terminatedPods, err := BuildTerminatedPodsInfo(ctx, clientset, opts)
 	if err != nil {
 		return nil, fmt.Errorf("unable to build terminated pod information: %w", err)
 	}
 
+	if opts.Owners != nil {
+		if err := resolveOwners(ctx, opts.Owners, terminatedPods); err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.Prometheus != nil {
+		if err := addMemoryPeaks(ctx, opts.Prometheus, terminatedPods); err != nil {
+			return nil, fmt.Errorf("unable to retrieve memory peaks: %w", err)
+		}
+	}
+
+	if opts.MemoryUsage && len(terminatedPods) > 0 {
+		// Without a metrics client, the usage is left unknown.
+		if metrics, err := factory.MetricsClient(); err == nil {
+			if err := addMemoryUsage(ctx, metrics, terminatedPods); err != nil {
+				return nil, fmt.Errorf("unable to retrieve memory usage: %w", err)
+			}
+		}
+	}
+
 	return terminatedPods, nil
 }
@@ -2,6 +2,7 @@ package plugin
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"io"
 	"net/http"
@@ -9,13 +10,19 @@ import (
 	"testing"
 	"time"
 
+	"github.com/jdockerty/kubectl-oomd/internal/testutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/suite"
 	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	k8syaml "k8s.io/apimachinery/pkg/util/yaml"
 	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
 	"k8s.io/kubectl/pkg/cmd"
 	"k8s.io/kubectl/pkg/scheme"
 )
@@ -114,7 +121,7 @@ func (rc *RequiresClusterTests) TearDownSuite() {
 // TestRunPlugin tests against an initialised cluster with OOMKilled pods that
 // the plugin's functionality works as expected.
 func (rc *RequiresClusterTests) TestRunPlugin() {
-	pods, err := Run(KubernetesConfigFlags, rc.IntegrationTestNamespace)
+	pods, err := Run(context.Background(), NewClientFactory(KubernetesConfigFlags), Options{Namespace: rc.IntegrationTestNamespace})
 	assert.Nil(rc.T(), err)
 
 	assert.Greater(rc.T(), len(pods), 0, "expected number of failed pods to be greater than 0, got %d", len(pods))
@@ -136,7 +143,7 @@ func (rc *RequiresClusterTests) TestCorrectResources() {
 	manifestReq, manifestLim, err := getMemoryRequestAndLimitFromDeploymentManifest(res.Body, knownIndex)
 	assert.Nil(rc.T(), err) // We don't skip this on failure, as if we got the manifest it should be a Deployment.
 
-	pods, _ := Run(KubernetesConfigFlags, rc.IntegrationTestNamespace)
+	pods, _ := Run(context.Background(), NewClientFactory(KubernetesConfigFlags), Options{Namespace: rc.IntegrationTestNamespace})
 
 	fmt.Println(manifestReq, manifestLim)
 	podMemoryRequest := pods[knownIndex].Pod.Spec.Containers[knownIndex].Resources.Requests["memory"]
@@ -191,48 +198,199 @@ func TestGetNamespace(t *testing.T) {
 }
 
 func TestFilterTerminatedPods(t *testing.T) {
-	testPods := []v1.Pod{
-		v1.Pod{
-			ObjectMeta: metav1.ObjectMeta{
-				Name: "oomedPod",
+
+	oomKilled := testutil.ContainerStatus("app", 137, "OOMKilled")
+	oomKilledSidecar := testutil.ContainerStatus("sidecar", 137, "OOMKilled")
+	completedSidecar := testutil.ContainerStatus("sidecar", 0, "Completed")
+	runningSidecar := v1.ContainerStatus{Name: "sidecar", State: v1.ContainerState{Running: &v1.ContainerStateRunning{}}}
+
+	tests := map[string]struct {
+		pods []v1.Pod
+		want []string // The pod/container identities which are expected, in order.
+	}{
+		"single oomkilled container": {
+			pods: []v1.Pod{
+				{ObjectMeta: metav1.ObjectMeta{Name: "oomedPod"}, Status: v1.PodStatus{ContainerStatuses: []v1.ContainerStatus{oomKilled}}},
 			},
-			Status: v1.PodStatus{
-				ContainerStatuses: []v1.ContainerStatus{
-					v1.ContainerStatus{
-						LastTerminationState: v1.ContainerState{
-							Terminated: &v1.ContainerStateTerminated{
-								ExitCode: 137,
-								Reason:   "OOMKilled",
-							},
-						},
-					},
-				},
+			want: []string{"oomedPod/app"},
+		},
+		"completed container is ignored": {
+			pods: []v1.Pod{
+				{ObjectMeta: metav1.ObjectMeta{Name: "okayPod"}, Status: v1.PodStatus{ContainerStatuses: []v1.ContainerStatus{testutil.ContainerStatus("app", 0, "Completed")}}},
 			},
+			want: nil,
 		},
-		v1.Pod{
-			ObjectMeta: metav1.ObjectMeta{
-				Name: "okayPod",
+		"oomkilled job container": {
+			pods: []v1.Pod{
+				{ObjectMeta: metav1.ObjectMeta{Name: "oomedJobPod"}, Status: v1.PodStatus{ContainerStatuses: []v1.ContainerStatus{
+					{Name: "job", State: v1.ContainerState{Terminated: &v1.ContainerStateTerminated{ExitCode: 137, Reason: "OOMKilled"}}},
+				}}},
+			},
+			want: []string{"oomedJobPod/job"},
+		},
+		"oomkilled init container": {
+			pods: []v1.Pod{
+				{ObjectMeta: metav1.ObjectMeta{Name: "oomedInitPod"}, Status: v1.PodStatus{InitContainerStatuses: []v1.ContainerStatus{oomKilled}}},
+			},
+			want: []string{"oomedInitPod/app"},
+		},
+		"multi-container pod only lists the oomkilled container": {
+			pods: []v1.Pod{
+				{ObjectMeta: metav1.ObjectMeta{Name: "sidecarPod"}, Status: v1.PodStatus{ContainerStatuses: []v1.ContainerStatus{oomKilled, completedSidecar}}},
+			},
+			want: []string{"sidecarPod/app"},
+		},
+		"multi-container pod with a running sidecar": {
+			pods: []v1.Pod{
+				{ObjectMeta: metav1.ObjectMeta{Name: "sidecarPod"}, Status: v1.PodStatus{ContainerStatuses: []v1.ContainerStatus{runningSidecar, oomKilled}}},
+			},
+			want: []string{"sidecarPod/app"},
+		},
+		"multi-container pod with every container oomkilled is not duplicated": {
+			pods: []v1.Pod{
+				{ObjectMeta: metav1.ObjectMeta{Name: "sidecarPod"}, Status: v1.PodStatus{ContainerStatuses: []v1.ContainerStatus{oomKilled, oomKilledSidecar}}},
+			},
+			want: []string{"sidecarPod/app", "sidecarPod/sidecar"},
+		},
+		"multiple pods": {
+			pods: []v1.Pod{
+				{ObjectMeta: metav1.ObjectMeta{Name: "first"}, Status: v1.PodStatus{ContainerStatuses: []v1.ContainerStatus{oomKilled, completedSidecar}}},
+				{ObjectMeta: metav1.ObjectMeta{Name: "okayPod"}, Status: v1.PodStatus{ContainerStatuses: []v1.ContainerStatus{runningSidecar}}},
+				{ObjectMeta: metav1.ObjectMeta{Name: "second"}, Status: v1.PodStatus{ContainerStatuses: []v1.ContainerStatus{runningSidecar, oomKilled}}},
+			},
+			want: []string{"first/app", "second/app"},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+
+			var got []string
+			for _, c := range TerminatedPodsFilter(tc.pods, DefaultClassifier{}) {
+				got = append(got, fmt.Sprintf("%s/%s", c.Pod.Name, c.ContainerName))
+			}
+
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestBuildTerminatedPodsInfo(t *testing.T) {
+
+	limits := func(memory string) v1.ResourceRequirements {
+		return v1.ResourceRequirements{
+			Limits: v1.ResourceList{v1.ResourceMemory: resource.MustParse(memory)},
+		}
+	}
+
+	pods := []v1.Pod{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "sidecarPod"},
+			Spec: v1.PodSpec{
+				Containers: []v1.Container{
+					{Name: "sidecar", Resources: limits("64Mi")},
+					{Name: "app", Resources: limits("128Mi")},
+				},
 			},
 			Status: v1.PodStatus{
+				// The statuses are intentionally in a different order to the specification.
 				ContainerStatuses: []v1.ContainerStatus{
-					v1.ContainerStatus{
-						LastTerminationState: v1.ContainerState{
-							Terminated: &v1.ContainerStateTerminated{
-								ExitCode: 0,
-								Reason:   "Completed",
-							},
-						},
-					},
+					testutil.ContainerStatus("app", 137, "OOMKilled"),
+					testutil.ContainerStatus("sidecar", 0, "Completed"),
 				},
 			},
 		},
 	}
 
-	oomed := TerminatedPodsFilter(testPods)
+	info, err := buildTerminatedPodsInfo(pods, DefaultClassifier{})
+	assert.Nil(t, err)
+
+	assert.Equal(t, 1, len(info))
+	assert.Equal(t, "app", info[0].ContainerName)
+	assert.Equal(t, "128Mi", info[0].Memory.Limit)
+	assert.Equal(t, CategoryOOMKilled, info[0].Category)
+}
+
+func TestGetContainerResources(t *testing.T) {
+
+	resources := func(memory string) v1.ResourceRequirements {
+		return v1.ResourceRequirements{
+			Limits: v1.ResourceList{v1.ResourceMemory: resource.MustParse(memory)},
+		}
+	}
+
+	pod := v1.Pod{
+		Spec: v1.PodSpec{
+			InitContainers: []v1.Container{{Name: "sidecar", Resources: resources("64Mi")}},
+			Containers:     []v1.Container{{Name: "app", Resources: resources("128Mi")}, {Name: "sidecar", Resources: resources("256Mi")}},
+			EphemeralContainers: []v1.EphemeralContainer{
+				{EphemeralContainerCommon: v1.EphemeralContainerCommon{Name: "debugger"}},
+			},
+		},
+	}
+
+	tests := map[string]struct {
+		name          string
+		containerType ContainerType
+		wantLimit     string
+		wantErr       bool
+	}{
+		"regular container":           {name: "app", containerType: ContainerTypeRegular, wantLimit: "128Mi"},
+		"init container":              {name: "sidecar", containerType: ContainerTypeInit, wantLimit: "64Mi"},
+		"same name as init container": {name: "sidecar", containerType: ContainerTypeRegular, wantLimit: "256Mi"},
+		"ephemeral container":         {name: "debugger", containerType: ContainerTypeEphemeral, wantLimit: "0"},
+		"unknown container":           {name: "app", containerType: ContainerTypeInit, wantErr: true},
+	}
 
-	assert.Equal(t, 1, len(oomed))
-	assert.Equal(t, "oomedPod", oomed[0].Name)
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			res, err := getContainerResources(tc.name, tc.containerType, pod)
+			if tc.wantErr {
+				assert.NotNil(t, err)
+				return
+			}
+
+			assert.Nil(t, err)
+			assert.Equal(t, tc.wantLimit, res.Limits.Memory().String())
+		})
+	}
+}
+
+func TestContainerTerminations(t *testing.T) {
+
+	current := &v1.ContainerStateTerminated{ExitCode: 137, Reason: "OOMKilled"}
+	last := &v1.ContainerStateTerminated{ExitCode: 1, Reason: "Error"}
+
+	tests := map[string]struct {
+		status v1.ContainerStatus
+		want   []containerTermination
+	}{
+		"running container": {
+			status: v1.ContainerStatus{State: v1.ContainerState{Running: &v1.ContainerStateRunning{}}},
+			want:   nil,
+		},
+		"restarted container": {
+			status: v1.ContainerStatus{LastTerminationState: v1.ContainerState{Terminated: last}},
+			want:   []containerTermination{{state: TerminationStateLast, terminated: last}},
+		},
+		"never restarted container": {
+			status: v1.ContainerStatus{State: v1.ContainerState{Terminated: current}},
+			want:   []containerTermination{{state: TerminationStateCurrent, terminated: current}},
+		},
+		"terminated again after restart": {
+			status: v1.ContainerStatus{State: v1.ContainerState{Terminated: current}, LastTerminationState: v1.ContainerState{Terminated: last}},
+			want: []containerTermination{
+				{state: TerminationStateCurrent, terminated: current},
+				{state: TerminationStateLast, terminated: last},
+			},
+		},
+	}
 
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.want, containerTerminations(tc.status))
+		})
+	}
 }
 
 func TestSortByTimestamp(t *testing.T) {
@@ -264,3 +422,164 @@ func TestSortByTimestamp(t *testing.T) {
 	t.Log("Pods are in descending order.")
 
 }
+
+func TestTerminatedPodInfoTermination(t *testing.T) {
+
+	started := time.Date(2022, 11, 7, 13, 0, 0, 0, time.UTC)
+	current := &v1.ContainerStateTerminated{ExitCode: 137, Reason: "OOMKilled"}
+	last := &v1.ContainerStateTerminated{ExitCode: 1, Reason: "Error"}
+
+	pod := v1.Pod{
+		Status: v1.PodStatus{
+			ContainerStatuses: []v1.ContainerStatus{
+				{Name: "app", State: v1.ContainerState{Terminated: current}, LastTerminationState: v1.ContainerState{Terminated: last}},
+			},
+		},
+	}
+
+	info := TerminatedPodInfo{
+		Pod:            pod,
+		ContainerName:  "app",
+		ContainerType:  ContainerTypeRegular,
+		State:          TerminationStateCurrent,
+		startTime:      started,
+		terminatedTime: started.Add(90 * time.Second),
+	}
+
+	assert.Equal(t, current, info.Termination())
+	assert.Equal(t, 90*time.Second, info.RunDuration())
+
+	info.State = TerminationStateLast
+	assert.Equal(t, last, info.Termination())
+
+	info.ContainerType = ContainerTypeInit
+	assert.Nil(t, info.Termination(), "container with the same name but another type should not match")
+}
+
+func TestRunWithFakeClient(t *testing.T) {
+
+	pod := func(namespace, name, app string, exitCode int32, reason string) runtime.Object {
+		p := testutil.Pod(namespace, name, exitCode, reason)
+		p.Labels = map[string]string{"app": app}
+		p.Spec.Containers[0].Resources.Requests = v1.ResourceList{v1.ResourceMemory: resource.MustParse("64Mi")}
+		return p
+	}
+
+	objects := []runtime.Object{
+		pod("shop", "checkout-1", "checkout", 137, "OOMKilled"),
+		pod("shop", "checkout-2", "checkout", 137, "Error"),
+		pod("shop", "checkout-3", "checkout", 0, "Completed"),
+		pod("shop", "payments-1", "payments", 137, "OOMKilled"),
+		pod("other", "checkout-1", "checkout", 137, "OOMKilled"),
+	}
+
+	tests := map[string]struct {
+		opts Options
+		want []string
+	}{
+		"single namespace": {
+			opts: Options{Namespace: "shop"},
+			want: []string{"shop/checkout-1", "shop/checkout-2", "shop/payments-1"},
+		},
+		"all namespaces": {
+			opts: Options{Namespace: metav1.NamespaceAll},
+			want: []string{"other/checkout-1", "shop/checkout-1", "shop/checkout-2", "shop/payments-1"},
+		},
+		"strict": {
+			opts: Options{Namespace: "shop", Classifier: DefaultClassifier{Strict: true}},
+			want: []string{"shop/checkout-1", "shop/payments-1"},
+		},
+		"label selector": {
+			opts: Options{Namespace: metav1.NamespaceAll, LabelSelector: "app=checkout"},
+			want: []string{"other/checkout-1", "shop/checkout-1", "shop/checkout-2"},
+		},
+		"targets": {
+			opts: Options{
+				Namespace: "shop",
+				Targets: []Target{
+					{Name: "Deployment/payments", Namespace: "shop", LabelSelector: "app=payments"},
+					{Name: "Service/payments", Namespace: "shop", LabelSelector: "app=payments"},
+				},
+			},
+			want: []string{"shop/payments-1"},
+		},
+		"no pods": {
+			opts: Options{Namespace: "empty"},
+			want: nil,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+
+			factory := testutil.ClientFactory{
+				RESTClientGetter: genericclioptions.NewTestConfigFlags(),
+				Client:           fake.NewSimpleClientset(objects...),
+			}
+
+			pods, err := Run(context.Background(), factory, tc.opts)
+			assert.Nil(t, err)
+
+			var got []string
+			for _, p := range pods {
+				got = append(got, fmt.Sprintf("%s/%s", p.Pod.Namespace, p.Pod.Name))
+				assert.Equal(t, "128Mi", p.Memory.Limit)
+				assert.Equal(t, "64Mi", p.Memory.Request)
+			}
+
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestRunPushesDownSelectors(t *testing.T) {
+
+	client := fake.NewSimpleClientset()
+	factory := testutil.ClientFactory{RESTClientGetter: genericclioptions.NewTestConfigFlags(), Client: client}
+
+	_, err := Run(context.Background(), factory, Options{Namespace: "shop", LabelSelector: "app=checkout", NodeName: "node-1"})
+	assert.Nil(t, err)
+
+	actions := client.Actions()
+	assert.Equal(t, 1, len(actions))
+
+	restrictions := actions[0].(k8stesting.ListAction).GetListRestrictions()
+	assert.Equal(t, "app=checkout", restrictions.Labels.String())
+	assert.Equal(t, "spec.nodeName=node-1", restrictions.Fields.String())
+}
+
+func TestRunResolvesOwners(t *testing.T) {
+
+	controller := true
+	report := testutil.Pod("shop", "report-27893-abcde", 137, "OOMKilled")
+	report.OwnerReferences = []metav1.OwnerReference{{APIVersion: "batch/v1", Kind: "Job", Name: "report-27893", Controller: &controller}}
+
+	job := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "report-27893", OwnerReferences: []metav1.OwnerReference{{APIVersion: "batch/v1", Kind: "CronJob", Name: "report", Controller: &controller}}}}
+
+	metadataClient := testutil.MetadataClient(job)
+	factory := testutil.ClientFactory{
+		RESTClientGetter: genericclioptions.NewTestConfigFlags(),
+		Client:           fake.NewSimpleClientset(report, testutil.Pod("shop", "debug", 137, "OOMKilled")),
+		Metadata:         metadataClient,
+	}
+
+	// The owners are only resolved when they are asked for.
+	pods, err := Run(context.Background(), factory, Options{Namespace: "shop"})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(pods))
+	assert.Equal(t, "", pods[0].Owner+pods[1].Owner)
+	assert.Equal(t, 0, len(metadataClient.Actions()))
+
+	resolver, err := NewOwnerResolver(factory)
+	assert.Nil(t, err)
+
+	pods, err = Run(context.Background(), factory, Options{Namespace: "shop", Owners: resolver})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(pods))
+
+	owners := make(map[string]string)
+	for _, p := range pods {
+		owners[p.Pod.Name] = p.ToTermination().Owner
+	}
+	assert.Equal(t, map[string]string{"debug": "", "report-27893-abcde": "CronJob/report"}, owners)
+}
@@ -0,0 +1,211 @@
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"text/template"
+	"time"
+
+	"github.com/prometheus/client_golang/api"
+	promv1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// DefaultPrometheusQuery is the query for the memory of a terminated container,
+// this is the working set reported by the kubelet's cAdvisor metrics. It is given
+// a Termination, so any of its fields may be used in a custom query.
+const DefaultPrometheusQuery = `max(container_memory_working_set_bytes{namespace="{{ .Namespace }}", pod="{{ .Pod }}", container="{{ .Container }}"})`
+
+const (
+	// DefaultPrometheusStep is the resolution of the memory queried from Prometheus,
+	// which matches the default scrape interval of the kubelet.
+	DefaultPrometheusStep = 15 * time.Second
+
+	// maxPrometheusPoints is the number of points which Prometheus allows in a
+	// single range query, the step is increased for long running containers.
+	maxPrometheusPoints = 11000
+)
+
+// PrometheusOptions configures how the memory of terminated containers is
+// queried from a Prometheus compatible API, such as Thanos or Mimir.
+type PrometheusOptions struct {
+	// URL of the Prometheus server, such as `http://prometheus.monitoring:9090`.
+	URL string
+
+	// Query returns the memory of a single container in bytes, as a Go template
+	// which is given a Termination. DefaultPrometheusQuery is used when empty.
+	Query string
+
+	// Step is the resolution of the query, DefaultPrometheusStep is used when 0.
+	Step time.Duration
+}
+
+// Prometheus retrieves the memory of terminated containers leading up to their
+// termination, so that their limits can be sized from how they actually behaved.
+type Prometheus struct {
+	api   promv1.API
+	query *template.Template
+	step  time.Duration
+}
+
+// NewPrometheus returns a Prometheus client, the query template is parsed straight
+// away so that mistakes are surfaced before anything is queried.
+func NewPrometheus(opts PrometheusOptions) (*Prometheus, error) {
+
+	if opts.Query == "" {
+		opts.Query = DefaultPrometheusQuery
+	}
+
+	if opts.Step == 0 {
+		opts.Step = DefaultPrometheusStep
+	}
+
+	query, err := template.New("query").Option("missingkey=error").Parse(opts.Query)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Prometheus query: %w", err)
+	}
+
+	client, err := api.NewClient(api.Config{Address: opts.URL})
+	if err != nil {
+		return nil, fmt.Errorf("invalid Prometheus URL: %w", err)
+	}
+
+	return &Prometheus{api: promv1.NewAPI(client), query: query, step: opts.Step}, nil
+}
+
+// MemoryPeak is the memory of a container between it starting and being terminated.
+type MemoryPeak struct {
+	// Peak is the highest memory seen, the true peak may be higher still as it
+	// is only sampled once per step.
+	Peak resource.Quantity
+
+	// GrowthPerMinute is how quickly the memory grew, as the slope of a line
+	// fitted to every sample. This is nil when there were too few samples.
+	GrowthPerMinute *resource.Quantity
+}
+
+// MemoryPeak queries the memory of the terminated container over the time it ran
+// for. This is false when it is unknown, such as when the start time was not
+// recorded or Prometheus has no samples for the container.
+func (p *Prometheus) MemoryPeak(ctx context.Context, t TerminatedPodInfo) (MemoryPeak, bool, error) {
+
+	if t.RunDuration() <= 0 {
+		return MemoryPeak{}, false, nil
+	}
+
+	var query bytes.Buffer
+	if err := p.query.Execute(&query, t.ToTermination()); err != nil {
+		return MemoryPeak{}, false, fmt.Errorf("unable to render Prometheus query for %s/%s: %w", t.Pod.Namespace, t.Pod.Name, err)
+	}
+
+	step := p.step
+	if points := t.RunDuration() / step; points > maxPrometheusPoints {
+		step = (t.RunDuration() / maxPrometheusPoints).Truncate(time.Second) + time.Second
+	}
+
+	value, _, err := p.api.QueryRange(ctx, query.String(), promv1.Range{Start: t.startTime, End: t.terminatedTime, Step: step})
+	if err != nil {
+		return MemoryPeak{}, false, fmt.Errorf("unable to query Prometheus for %s/%s: %w", t.Pod.Namespace, t.Pod.Name, err)
+	}
+
+	matrix, ok := value.(model.Matrix)
+	if !ok {
+		return MemoryPeak{}, false, fmt.Errorf("unable to query Prometheus for %s/%s: expected a matrix, got %s", t.Pod.Namespace, t.Pod.Name, value.Type())
+	}
+
+	// Custom queries may return multiple series, these are treated as one.
+	var samples []model.SamplePair
+	for _, series := range matrix {
+		samples = append(samples, series.Values...)
+	}
+
+	if len(samples) == 0 {
+		return MemoryPeak{}, false, nil
+	}
+
+	return memoryPeak(samples), true, nil
+}
+
+// memoryPeak returns the peak and growth of the samples, which must not be empty.
+func memoryPeak(samples []model.SamplePair) MemoryPeak {
+
+	peak := samples[0].Value
+	for _, s := range samples {
+		if s.Value > peak {
+			peak = s.Value
+		}
+	}
+
+	result := MemoryPeak{Peak: *resource.NewQuantity(int64(peak), resource.BinarySI)}
+
+	// The growth is the slope of the least squares line through the samples,
+	// so that a single spike does not dominate it.
+	var sumX, sumY, sumXY, sumXX float64
+	n := float64(len(samples))
+	start := samples[0].Timestamp
+
+	for _, s := range samples {
+		x := s.Timestamp.Sub(start).Minutes()
+		y := float64(s.Value)
+		sumX += x
+		sumY += y
+		sumXY += x * y
+		sumXX += x * x
+	}
+
+	if denominator := n*sumXX - sumX*sumX; denominator > 0 {
+		slope := (n*sumXY - sumX*sumY) / denominator
+		result.GrowthPerMinute = resource.NewQuantity(int64(slope), resource.BinarySI)
+	}
+
+	return result
+}
+
+// addMemoryPeaks sets the peak memory and its growth of the terminated containers
+// from Prometheus. Unlike the metrics API, Prometheus is explicitly configured, so
+// failing to query it is returned as an error.
+func addMemoryPeaks(ctx context.Context, prometheus *Prometheus, pods TerminatedPods) error {
+
+	for i := range pods {
+		p := &pods[i]
+
+		peak, ok, err := prometheus.MemoryPeak(ctx, *p)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+
+		p.Memory.Peak = roundedMemory(peak.Peak)
+		p.Memory.peak = peak.Peak
+
+		if peak.GrowthPerMinute != nil {
+			p.Memory.GrowthPerMinute = roundedMemory(*peak.GrowthPerMinute)
+			p.Memory.growthPerMinute = *peak.GrowthPerMinute
+		}
+	}
+
+	return nil
+}
+
+// roundedMemory rounds memory from Prometheus, which is an exact number of bytes,
+// to the nearest Mi or Ki so that it is displayed in the same form as a limit.
+func roundedMemory(q resource.Quantity) string {
+
+	value := q.Value()
+
+	unit := int64(1024 * 1024)
+	if value < unit && value > -unit {
+		unit = 1024
+	}
+
+	rounded := (value + unit/2) / unit * unit
+	if value < 0 {
+		rounded = (value - unit/2) / unit * unit
+	}
+
+	return resource.NewQuantity(rounded, resource.BinarySI).String()
+}
@@ -0,0 +1,224 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jdockerty/kubectl-oomd/internal/testutil"
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// prometheusServer is a fake Prometheus which responds to range queries with
+// the samples, recording the queries it receives.
+type prometheusServer struct {
+	*httptest.Server
+
+	mu      sync.Mutex
+	queries []url.Values
+}
+
+func newPrometheusServer(samples ...[2]float64) *prometheusServer {
+
+	s := &prometheusServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		if r.URL.Path != "/api/v1/query_range" {
+			http.NotFound(w, r)
+			return
+		}
+
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		s.mu.Lock()
+		s.queries = append(s.queries, r.Form)
+		s.mu.Unlock()
+
+		result := []interface{}{}
+		if len(samples) > 0 {
+			var values [][]interface{}
+			for _, sample := range samples {
+				values = append(values, []interface{}{sample[0], model.SampleValue(sample[1]).String()})
+			}
+			result = append(result, map[string]interface{}{"metric": map[string]string{}, "values": values})
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status": "success",
+			"data":   map[string]interface{}{"resultType": "matrix", "result": result},
+		})
+	}))
+
+	return s
+}
+
+// prometheusPod returns a terminated container which ran for 10 minutes.
+func prometheusPod(name string) *v1.Pod {
+
+	pod := testutil.Pod("shop", name, 137, "OOMKilled")
+	terminated := pod.Status.ContainerStatuses[0].LastTerminationState.Terminated
+	terminated.StartedAt = metav1.NewTime(time.Date(2023, 1, 2, 3, 0, 0, 0, time.UTC))
+	terminated.FinishedAt = metav1.NewTime(time.Date(2023, 1, 2, 3, 10, 0, 0, time.UTC))
+
+	return pod
+}
+
+func TestRunMemoryPeak(t *testing.T) {
+
+	start := float64(time.Date(2023, 1, 2, 3, 0, 0, 0, time.UTC).Unix())
+
+	// Growing by 8Mi a minute, from 48Mi to 128Mi.
+	var samples [][2]float64
+	for minute := 0; minute <= 10; minute++ {
+		samples = append(samples, [2]float64{start + float64(minute*60), float64((48 + minute*8) * 1024 * 1024)})
+	}
+
+	server := newPrometheusServer(samples...)
+	defer server.Close()
+
+	prometheus, err := NewPrometheus(PrometheusOptions{URL: server.URL})
+	assert.Nil(t, err)
+
+	factory := testutil.ClientFactory{
+		RESTClientGetter: genericclioptions.NewTestConfigFlags(),
+		Client:           fake.NewSimpleClientset(prometheusPod("checkout-1")),
+	}
+
+	pods, err := Run(context.Background(), factory, Options{Namespace: "shop", Prometheus: prometheus})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(pods))
+
+	assert.Equal(t, "128Mi", pods[0].Memory.Peak)
+	assert.Equal(t, "8Mi", pods[0].Memory.GrowthPerMinute)
+
+	memory := pods[0].ToTermination().Memory
+	assert.Equal(t, int64(128*1024*1024), memory.Peak.Bytes)
+	assert.Equal(t, int64(8*1024*1024), memory.GrowthPerMinute.Bytes)
+
+	assert.Equal(t, 1, len(server.queries))
+	query := server.queries[0]
+	assert.Equal(t, `max(container_memory_working_set_bytes{namespace="shop", pod="checkout-1", container="app"})`, query.Get("query"))
+	assert.Equal(t, "1672628400", query.Get("start"))
+	assert.Equal(t, "1672629000", query.Get("end"))
+	assert.Equal(t, "15", query.Get("step"))
+}
+
+func TestMemoryPeakUnknown(t *testing.T) {
+
+	server := newPrometheusServer()
+	defer server.Close()
+
+	prometheus, err := NewPrometheus(PrometheusOptions{URL: server.URL, Query: `memory{pod="{{ .Pod }}"}`})
+	assert.Nil(t, err)
+
+	tests := map[string]struct {
+		pod         *v1.Pod
+		wantQueried bool
+	}{
+		"no samples":    {pod: prometheusPod("checkout-1"), wantQueried: true},
+		"no start time": {pod: testutil.Pod("shop", "checkout-2", 137, "OOMKilled")},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+
+			pods, err := buildTerminatedPodsInfo([]v1.Pod{*tc.pod}, DefaultClassifier{})
+			assert.Nil(t, err)
+
+			server.queries = nil
+			assert.Nil(t, addMemoryPeaks(context.Background(), prometheus, pods))
+
+			assert.Equal(t, "", pods[0].Memory.Peak)
+			assert.Equal(t, "", pods[0].Memory.GrowthPerMinute)
+			assert.Nil(t, pods[0].ToTermination().Memory.Peak)
+			assert.Equal(t, tc.wantQueried, len(server.queries) == 1)
+		})
+	}
+}
+
+func TestMemoryPeakUnavailable(t *testing.T) {
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"status":"error","errorType":"bad_data","error":"parse error"}`))
+	}))
+	defer server.Close()
+
+	prometheus, err := NewPrometheus(PrometheusOptions{URL: server.URL})
+	assert.Nil(t, err)
+
+	factory := testutil.ClientFactory{
+		RESTClientGetter: genericclioptions.NewTestConfigFlags(),
+		Client:           fake.NewSimpleClientset(prometheusPod("checkout-1")),
+	}
+
+	_, err = Run(context.Background(), factory, Options{Namespace: "shop", Prometheus: prometheus})
+	assert.NotNil(t, err, "Prometheus was explicitly configured, so failing to query it should be an error")
+}
+
+func TestMemoryPeakGrowth(t *testing.T) {
+
+	tests := map[string]struct {
+		samples    [][2]float64
+		wantPeak   int64
+		wantGrowth int64
+		noGrowth   bool
+	}{
+		"single sample": {
+			samples:  [][2]float64{{0, 100}},
+			wantPeak: 100,
+			noGrowth: true,
+		},
+		"flat with a spike": {
+			samples:    [][2]float64{{0, 100}, {60, 1000}, {120, 100}},
+			wantPeak:   1000,
+			wantGrowth: 0,
+		},
+		"shrinking": {
+			samples:    [][2]float64{{0, 300}, {60, 200}, {120, 100}},
+			wantPeak:   300,
+			wantGrowth: -100,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+
+			var samples []model.SamplePair
+			for _, s := range tc.samples {
+				samples = append(samples, model.SamplePair{Timestamp: model.TimeFromUnix(int64(s[0])), Value: model.SampleValue(s[1])})
+			}
+
+			got := memoryPeak(samples)
+			assert.Equal(t, tc.wantPeak, got.Peak.Value())
+
+			if tc.noGrowth {
+				assert.Nil(t, got.GrowthPerMinute)
+				return
+			}
+			assert.Equal(t, tc.wantGrowth, got.GrowthPerMinute.Value())
+		})
+	}
+}
+
+func TestNewPrometheusInvalid(t *testing.T) {
+
+	_, err := NewPrometheus(PrometheusOptions{URL: "http://prometheus:9090", Query: "{{ .Pod"})
+	assert.NotNil(t, err)
+
+	_, err = NewPrometheus(PrometheusOptions{URL: "://prometheus"})
+	assert.NotNil(t, err)
+}
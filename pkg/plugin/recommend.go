@@ -0,0 +1,392 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/duration"
+)
+
+const (
+	// RecommendationKind is the kind of a single recommendation.
+	RecommendationKind = "Recommendation"
+
+	// RecommendationListKind is the kind of a list of recommendations.
+	RecommendationListKind = "RecommendationList"
+
+	// DefaultHeadroom is the fraction of memory added for each recent OOM.
+	DefaultHeadroom = 0.25
+
+	// DefaultRecentWindow is how recently an OOM must have been to be recent.
+	DefaultRecentWindow = 24 * time.Hour
+
+	// maxHeadroomOOMs is the number of OOMs which the headroom is added for, so
+	// that a container stuck in a crash loop does not get an absurd limit.
+	maxHeadroomOOMs = 3
+)
+
+// RecommendOptions is the policy used to recommend the memory of containers.
+type RecommendOptions struct {
+	// Headroom is the fraction of memory added on top of what the container was
+	// seen to need, for each recent OOM up to 3. DefaultHeadroom is used when 0.
+	Headroom float64
+
+	// RecentWindow is how recently an OOM must have been for its headroom to be
+	// added. DefaultRecentWindow is used when 0.
+	RecentWindow time.Duration
+
+	// History is the recorded terminations, whose OOMs are counted along with those
+	// of the pods, such as the earlier OOMs of a container which has restarted.
+	History []Termination
+
+	// now is when the recent window ends, the current time is used when zero.
+	now time.Time
+}
+
+// RecommendationList is a list of recommendations, used for machine readable
+// output such as JSON and YAML.
+type RecommendationList struct {
+	metav1.TypeMeta `json:",inline"`
+
+	Items []Recommendation `json:"items"`
+}
+
+// Recommendation is the memory request and limit proposed for a container of a
+// workload, which was OOMKilled by its current limit.
+type Recommendation struct {
+	metav1.TypeMeta `json:",inline"`
+
+	Namespace string `json:"namespace"`
+
+	// Workload is the owner of the pods, or the pod itself when it does not have one.
+	Workload  string `json:"workload"`
+	Container string `json:"container"`
+
+	// Pod is the most recently OOMKilled pod of the workload.
+	Pod string `json:"pod"`
+
+	// OOMs is the number of OOMKilled terminations of the container in the workload,
+	// which were seen in the pods or recorded in the history.
+	OOMs int `json:"ooms"`
+
+	// RecentOOMs is how many of the OOMs were within the recent window.
+	RecentOOMs int `json:"recentOOMs"`
+
+	// Restarts is the number of restarts of the container in the pods, for any
+	// reason, as Kubernetes only keeps the reason of the last termination.
+	Restarts int `json:"restarts"`
+
+	// Current is the memory of the container as it was when it was OOMKilled,
+	// the highest of each is used across the pods of the workload.
+	Current MemoryQuantities `json:"current"`
+
+	// Recommended is the proposed request and limit, these are omitted when there
+	// is nothing to base them on, such as without a limit or any usage.
+	Recommended MemoryQuantities `json:"recommended"`
+
+	// Rationale explains how the recommendation was reached.
+	Rationale string `json:"rationale"`
+}
+
+// recommendationKey groups the terminations of the same container in a workload.
+type recommendationKey struct {
+	namespace, workload, container string
+}
+
+// Recommend proposes a new memory request and limit for each container which was
+// OOMKilled, terminations for other reasons are ignored. The pods are grouped by
+// their top-level workload, such as the CronJob of a Job, so there is a single
+// recommendation for each container.
+//
+// The limit is what the container was seen to need, which is at least the limit it
+// was killed at, plus the headroom for each recent OOM. The request covers the
+// highest usage seen, plus a single headroom, without exceeding the new limit.
+func Recommend(ctx context.Context, owners *OwnerResolver, pods TerminatedPods, opts RecommendOptions) (*RecommendationList, error) {
+
+	groups := make(map[recommendationKey]TerminatedPods)
+	for _, p := range pods {
+		if p.Category != CategoryOOMKilled {
+			continue
+		}
+
+		workload, err := owners.resolve(ctx, p.Pod)
+		if err != nil {
+			return nil, err
+		}
+
+		key := recommendationKey{p.Pod.Namespace, workload.String(), p.ContainerName}
+		groups[key] = append(groups[key], p)
+	}
+
+	items := make([]Recommendation, 0, len(groups))
+	for key, group := range groups {
+		items = append(items, recommend(key, group, opts))
+	}
+
+	sort.Slice(items, func(i, j int) bool {
+		a, b := items[i], items[j]
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		if a.Workload != b.Workload {
+			return a.Workload < b.Workload
+		}
+		return a.Container < b.Container
+	})
+
+	return &RecommendationList{
+		TypeMeta: metav1.TypeMeta{APIVersion: APIVersion, Kind: RecommendationListKind},
+		Items:    items,
+	}, nil
+}
+
+// containerKey identifies a container of a pod, which may have been reported for
+// both its current and last termination.
+type containerKey struct {
+	pod           types.UID
+	containerType ContainerType
+	name          string
+}
+
+// countOOMs returns the number of distinct OOMKilled terminations of the container,
+// from both the pods and the history, and how many of them were within the window
+// ending at now. Kubernetes only keeps the last termination of a container, so its
+// earlier OOMs are only known from the history.
+func countOOMs(key recommendationKey, group TerminatedPods, history []Termination, window time.Duration, now time.Time) (int, int) {
+
+	// A termination may be seen more than once, such as by a pod and the history.
+	terminated := make(map[string]time.Time)
+	for _, p := range group {
+		terminated[p.ToTermination().ID()] = p.terminatedTime
+	}
+	for _, t := range history {
+		if t.Category != CategoryOOMKilled || t.Namespace != key.namespace || t.workload() != key.workload || t.Container != key.container {
+			continue
+		}
+		terminated[t.ID()] = t.TerminatedTime.Time
+	}
+
+	var recent int
+	for _, at := range terminated {
+		if !at.Before(now.Add(-window)) {
+			recent++
+		}
+	}
+
+	return len(terminated), recent
+}
+
+// countRestarts returns the number of restarts of the containers, for any reason.
+func countRestarts(group TerminatedPods) int {
+
+	restarts := make(map[containerKey]int32)
+	for _, p := range group {
+		if status, ok := p.ContainerStatus(); ok {
+			key := containerKey{p.Pod.UID, p.ContainerType, p.ContainerName}
+			if status.RestartCount > restarts[key] {
+				restarts[key] = status.RestartCount
+			}
+		}
+	}
+
+	var total int
+	for _, n := range restarts {
+		total += int(n)
+	}
+
+	return total
+}
+
+// recommend returns the recommendation for the terminations of a single container.
+func recommend(key recommendationKey, group TerminatedPods, opts RecommendOptions) Recommendation {
+
+	if opts.Headroom == 0 {
+		opts.Headroom = DefaultHeadroom
+	}
+	if opts.RecentWindow == 0 {
+		opts.RecentWindow = DefaultRecentWindow
+	}
+	if opts.now.IsZero() {
+		opts.now = time.Now()
+	}
+
+	// The highest of each is used, as the pods may be from different rollouts.
+	var request, limit, usage, peak, growth resource.Quantity
+	var latest TerminatedPodInfo
+	var hasGrowth bool
+
+	for _, p := range group {
+		request = maxQuantity(request, p.Memory.request)
+		limit = maxQuantity(limit, p.Memory.limit)
+		usage = maxQuantity(usage, p.Memory.usage)
+		peak = maxQuantity(peak, p.Memory.peak)
+
+		if p.Memory.GrowthPerMinute != "" && (!hasGrowth || p.Memory.growthPerMinute.Cmp(growth) > 0) {
+			growth, hasGrowth = p.Memory.growthPerMinute, true
+		}
+
+		if !p.terminatedTime.Before(latest.terminatedTime) {
+			latest = p
+		}
+	}
+
+	r := Recommendation{
+		TypeMeta:  metav1.TypeMeta{APIVersion: APIVersion, Kind: RecommendationKind},
+		Namespace: key.namespace,
+		Workload:  key.workload,
+		Container: key.container,
+		Pod:       latest.Pod.Name,
+		Current: MemoryQuantities{
+			Request: newMemoryQuantity(request),
+			Limit:   newMemoryQuantity(limit),
+			Usage:   newMemoryQuantity(usage),
+		},
+	}
+
+	r.OOMs, r.RecentOOMs = countOOMs(key, group, opts.History, opts.RecentWindow, opts.now)
+	r.Restarts = countRestarts(group)
+
+	// The OOMs are described along with how many were recent, when some were not.
+	described := ooms(r.OOMs)
+	switch {
+	case r.RecentOOMs == 0:
+		described = fmt.Sprintf("%s (none in the last %s)", described, duration.HumanDuration(opts.RecentWindow))
+	case r.RecentOOMs < r.OOMs:
+		described = fmt.Sprintf("%s (%d in the last %s)", described, r.RecentOOMs, duration.HumanDuration(opts.RecentWindow))
+	}
+
+	if !peak.IsZero() {
+		r.Current.Peak = newMeasuredMemoryQuantity(roundedMemory(peak), peak)
+	}
+
+	// The container needed at least the limit it was killed at, unless it has
+	// since been seen to use more.
+	observed := maxQuantity(usage, peak)
+	needed := maxQuantity(limit, observed)
+
+	var rationale []string
+
+	switch {
+	case needed.IsZero():
+		r.Rationale = fmt.Sprintf("%s without a memory limit or any known usage, so there is nothing to base a recommendation on", described)
+		return r
+	case limit.IsZero():
+		rationale = append(rationale, fmt.Sprintf("%s without a memory limit, using %s at most", described, roundedMemory(observed)))
+	case observed.Cmp(limit) > 0:
+		rationale = append(rationale, fmt.Sprintf("%s and has since used %s, more than the %s limit", described, roundedMemory(observed), limit.String()))
+	default:
+		rationale = append(rationale, fmt.Sprintf("%s at the %s limit", described, limit.String()))
+	}
+
+	// A single headroom is still added without any recent OOMs, as the container
+	// needed more than the limit it was killed at.
+	considered := r.RecentOOMs
+	if considered > maxHeadroomOOMs {
+		considered = maxHeadroomOOMs
+	}
+	if considered < 1 {
+		considered = 1
+	}
+	factor := 1 + opts.Headroom*float64(considered)
+
+	newLimit := scaleMemory(needed, factor)
+	if request.Cmp(newLimit) > 0 {
+		// The API server rejects a limit below the request, which is never lowered.
+		rationale = append(rationale, fmt.Sprintf("limit raised to the %s request, which is more than %s with %.0f%% headroom", request.String(), newLimit.String(), (factor-1)*100))
+		newLimit = request
+	} else {
+		rationale = append(rationale, fmt.Sprintf("limit raised to %s with %.0f%% headroom (%.0f%% per recent OOM, up to %d)", newLimit.String(), (factor-1)*100, opts.Headroom*100, maxHeadroomOOMs))
+	}
+	r.Recommended.Limit = newMemoryQuantity(newLimit)
+
+	newRequest := request
+	if !observed.IsZero() {
+		newRequest = maxQuantity(request, scaleMemory(observed, 1+opts.Headroom))
+	}
+
+	switch {
+	case newRequest.IsZero():
+	case newRequest.Cmp(request) == 0:
+		rationale = append(rationale, fmt.Sprintf("request kept at %s", newRequest.String()))
+	case newRequest.Cmp(newLimit) > 0:
+		newRequest = newLimit
+		rationale = append(rationale, fmt.Sprintf("request raised to the new limit, as the usage of %s with headroom is more than it", roundedMemory(observed)))
+	default:
+		rationale = append(rationale, fmt.Sprintf("request raised to %s to cover the usage of %s", newRequest.String(), roundedMemory(observed)))
+	}
+	r.Recommended.Request = newMemoryQuantity(newRequest)
+
+	// Only the reason of the last termination is known, so the other restarts are
+	// not counted as OOMs or added to the headroom.
+	if r.Restarts > r.OOMs {
+		rationale = append(rationale, fmt.Sprintf("restarted %d times, whose earlier reasons are not known", r.Restarts))
+	}
+
+	if hasGrowth && growth.Sign() > 0 {
+		rationale = append(rationale, fmt.Sprintf("memory grew by %s/min before the kill, which may be a leak that a higher limit only delays", roundedMemory(growth)))
+	}
+
+	r.Rationale = strings.Join(rationale, "; ")
+	return r
+}
+
+// ooms describes the number of OOMs, such as `OOMKilled 3 times`.
+func ooms(n int) string {
+	if n == 1 {
+		return "OOMKilled once"
+	}
+	return fmt.Sprintf("OOMKilled %d times", n)
+}
+
+// maxQuantity returns the larger of the quantities.
+func maxQuantity(a, b resource.Quantity) resource.Quantity {
+	if b.Cmp(a) > 0 {
+		return b
+	}
+	return a
+}
+
+// scaleMemory multiplies the memory by the factor, rounding up to the next Mi so
+// that the recommendation is a readable quantity.
+func scaleMemory(q resource.Quantity, factor float64) resource.Quantity {
+
+	const mebibyte = 1024 * 1024
+
+	scaled := int64(math.Ceil(float64(q.Value())*factor/mebibyte)) * mebibyte
+	return *resource.NewQuantity(scaled, resource.BinarySI)
+}
+
+// DeepCopyInto copies the receiver into out, both must be non-nil.
+func (in *Recommendation) DeepCopyInto(out *Recommendation) {
+	*out = *in
+	in.Current.DeepCopyInto(&out.Current)
+	in.Recommended.DeepCopyInto(&out.Recommended)
+}
+
+// DeepCopyObject implements runtime.Object.
+func (in *Recommendation) DeepCopyObject() runtime.Object {
+	out := new(Recommendation)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject implements runtime.Object.
+func (in *RecommendationList) DeepCopyObject() runtime.Object {
+	out := new(RecommendationList)
+	out.TypeMeta = in.TypeMeta
+	if in.Items != nil {
+		out.Items = make([]Recommendation, len(in.Items))
+		for i := range in.Items {
+			in.Items[i].DeepCopyInto(&out.Items[i])
+		}
+	}
+	return out
+}
@@ -0,0 +1,214 @@
+package plugin
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jdockerty/kubectl-oomd/internal/testutil"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// recommendationPod returns the terminated `app` container of a pod owned by the
+// checkout Deployment, with the given request and limit which may be empty.
+func recommendationPod(name, reason, request, limit string, hour int) TerminatedPodInfo {
+
+	controller := true
+	pod := testutil.Pod("shop", name, 137, reason)
+	pod.Labels = map[string]string{"pod-template-hash": "5bcbcdf97"}
+	pod.OwnerReferences = []metav1.OwnerReference{{Kind: "ReplicaSet", Name: "checkout-5bcbcdf97", Controller: &controller}}
+	pod.Status.ContainerStatuses[0].LastTerminationState.Terminated.FinishedAt = metav1.NewTime(time.Date(2023, 1, 2, hour, 0, 0, 0, time.UTC))
+
+	pod.Spec.Containers[0].Resources = v1.ResourceRequirements{Requests: v1.ResourceList{}, Limits: v1.ResourceList{}}
+	if request != "" {
+		pod.Spec.Containers[0].Resources.Requests[v1.ResourceMemory] = resource.MustParse(request)
+	}
+	if limit != "" {
+		pod.Spec.Containers[0].Resources.Limits[v1.ResourceMemory] = resource.MustParse(limit)
+	}
+
+	pods, _ := buildTerminatedPodsInfo([]v1.Pod{*pod}, DefaultClassifier{})
+	return pods[0]
+}
+
+// withRestarts sets the restart count of the container.
+func withRestarts(p TerminatedPodInfo, restarts int32) TerminatedPodInfo {
+	p.Pod.Status.ContainerStatuses[0].RestartCount = restarts
+	return p
+}
+
+// recommendationTime is when the recommendations are made, in the middle of the
+// day that the recommendation pods were terminated on.
+var recommendationTime = time.Date(2023, 1, 2, 12, 0, 0, 0, time.UTC)
+
+// withMemory sets the usage and peak of the container, either may be empty.
+func withMemory(p TerminatedPodInfo, usage, peak, growth string) TerminatedPodInfo {
+	if usage != "" {
+		p.Memory.Usage, p.Memory.usage = usage, resource.MustParse(usage)
+	}
+	if peak != "" {
+		p.Memory.Peak, p.Memory.peak = peak, resource.MustParse(peak)
+	}
+	if growth != "" {
+		p.Memory.GrowthPerMinute, p.Memory.growthPerMinute = growth, resource.MustParse(growth)
+	}
+	return p
+}
+
+func TestRecommend(t *testing.T) {
+
+	tests := map[string]struct {
+		pods          TerminatedPods
+		opts          RecommendOptions
+		wantOOMs      int
+		wantRecent    int
+		wantRequest   string
+		wantLimit     string
+		wantRationale string
+	}{
+		"single OOM at the limit": {
+			pods:          TerminatedPods{recommendationPod("checkout-1", "OOMKilled", "64Mi", "128Mi", 1)},
+			wantOOMs:      1,
+			wantRecent:    1,
+			wantRequest:   "64Mi",
+			wantLimit:     "160Mi",
+			wantRationale: "OOMKilled once at the 128Mi limit; limit raised to 160Mi with 25% headroom (25% per recent OOM, up to 3); request kept at 64Mi",
+		},
+		"repeated OOMs with usage": {
+			pods: TerminatedPods{
+				withMemory(recommendationPod("checkout-1", "OOMKilled", "64Mi", "128Mi", 1), "96Mi", "", ""),
+				recommendationPod("checkout-2", "OOMKilled", "64Mi", "128Mi", 2),
+			},
+			wantOOMs:      2,
+			wantRecent:    2,
+			wantRequest:   "120Mi",
+			wantLimit:     "192Mi",
+			wantRationale: "OOMKilled 2 times at the 128Mi limit; limit raised to 192Mi with 50% headroom (25% per recent OOM, up to 3); request raised to 120Mi to cover the usage of 96Mi",
+		},
+		"headroom is capped": {
+			pods: TerminatedPods{
+				recommendationPod("checkout-1", "OOMKilled", "", "100Mi", 1),
+				recommendationPod("checkout-2", "OOMKilled", "", "100Mi", 2),
+				recommendationPod("checkout-3", "OOMKilled", "", "100Mi", 3),
+				recommendationPod("checkout-4", "OOMKilled", "", "100Mi", 4),
+			},
+			opts:          RecommendOptions{Headroom: 0.5},
+			wantOOMs:      4,
+			wantRecent:    4,
+			wantLimit:     "250Mi",
+			wantRationale: "OOMKilled 4 times at the 100Mi limit; limit raised to 250Mi with 150% headroom (50% per recent OOM, up to 3)",
+		},
+		"no limit": {
+			pods:          TerminatedPods{withMemory(recommendationPod("checkout-1", "OOMKilled", "", "", 1), "", "800Mi", "")},
+			wantOOMs:      1,
+			wantRecent:    1,
+			wantRequest:   "1000Mi",
+			wantLimit:     "1000Mi",
+			wantRationale: "OOMKilled once without a memory limit, using 800Mi at most; limit raised to 1000Mi with 25% headroom (25% per recent OOM, up to 3); request raised to 1000Mi to cover the usage of 800Mi",
+		},
+		"growing memory": {
+			pods:          TerminatedPods{withMemory(recommendationPod("checkout-1", "OOMKilled", "128Mi", "128Mi", 1), "", "127Mi", "4Mi")},
+			wantOOMs:      1,
+			wantRecent:    1,
+			wantRequest:   "159Mi",
+			wantLimit:     "160Mi",
+			wantRationale: "OOMKilled once at the 128Mi limit; limit raised to 160Mi with 25% headroom (25% per recent OOM, up to 3); request raised to 159Mi to cover the usage of 127Mi; memory grew by 4Mi/min before the kill, which may be a leak that a higher limit only delays",
+		},
+		"restarts are not OOMs": {
+			pods:          TerminatedPods{withRestarts(recommendationPod("checkout-1", "OOMKilled", "", "128Mi", 1), 40)},
+			wantOOMs:      1,
+			wantRecent:    1,
+			wantLimit:     "160Mi",
+			wantRationale: "OOMKilled once at the 128Mi limit; limit raised to 160Mi with 25% headroom (25% per recent OOM, up to 3); restarted 40 times, whose earlier reasons are not known",
+		},
+		"OOMs from the history": {
+			pods: TerminatedPods{withRestarts(recommendationPod("checkout-1", "OOMKilled", "", "128Mi", 10), 2)},
+			opts: RecommendOptions{RecentWindow: 6 * time.Hour, History: []Termination{
+				historyTermination("shop", "checkout-1", "Deployment/checkout", 10),
+				historyTermination("shop", "checkout-1", "Deployment/checkout", 9),
+				historyTermination("shop", "checkout-1", "Deployment/checkout", 1),
+				historyTermination("shop", "payments-1", "Deployment/payments", 8),
+			}},
+			wantOOMs:      3,
+			wantRecent:    2,
+			wantLimit:     "192Mi",
+			wantRationale: "OOMKilled 3 times (2 in the last 6h) at the 128Mi limit; limit raised to 192Mi with 50% headroom (25% per recent OOM, up to 3)",
+		},
+		"no recent OOMs": {
+			pods:          TerminatedPods{recommendationPod("checkout-1", "OOMKilled", "", "128Mi", 1)},
+			opts:          RecommendOptions{RecentWindow: 6 * time.Hour},
+			wantOOMs:      1,
+			wantRecent:    0,
+			wantLimit:     "160Mi",
+			wantRationale: "OOMKilled once (none in the last 6h) at the 128Mi limit; limit raised to 160Mi with 25% headroom (25% per recent OOM, up to 3)",
+		},
+		"request above the new limit": {
+			pods:          TerminatedPods{withMemory(recommendationPod("checkout-1", "OOMKilled", "1Gi", "", 1), "200Mi", "", "")},
+			wantOOMs:      1,
+			wantRecent:    1,
+			wantRequest:   "1Gi",
+			wantLimit:     "1Gi",
+			wantRationale: "OOMKilled once without a memory limit, using 200Mi at most; limit raised to the 1Gi request, which is more than 250Mi with 25% headroom; request kept at 1Gi",
+		},
+		"nothing to base it on": {
+			pods:          TerminatedPods{recommendationPod("checkout-1", "OOMKilled", "", "", 1)},
+			wantOOMs:      1,
+			wantRecent:    1,
+			wantRationale: "OOMKilled once without a memory limit or any known usage, so there is nothing to base a recommendation on",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+
+			tc.opts.now = recommendationTime
+			list, err := Recommend(context.Background(), testOwnerResolver(), tc.pods, tc.opts)
+			assert.Nil(t, err)
+			assert.Equal(t, RecommendationListKind, list.Kind)
+			assert.Equal(t, 1, len(list.Items))
+
+			r := list.Items[0]
+			assert.Equal(t, "Deployment/checkout", r.Workload)
+			assert.Equal(t, "app", r.Container)
+			assert.Equal(t, tc.wantOOMs, r.OOMs)
+			assert.Equal(t, tc.wantRecent, r.RecentOOMs)
+			assert.Equal(t, tc.wantRationale, r.Rationale)
+
+			quantity := func(q *MemoryQuantity) string {
+				if q == nil {
+					return ""
+				}
+				return q.Quantity
+			}
+			assert.Equal(t, tc.wantRequest, quantity(r.Recommended.Request))
+			assert.Equal(t, tc.wantLimit, quantity(r.Recommended.Limit))
+		})
+	}
+}
+
+func TestRecommendGroupsWorkloads(t *testing.T) {
+
+	bare := recommendationPod("debug", "OOMKilled", "", "64Mi", 1)
+	bare.Pod.OwnerReferences = nil
+
+	pods := TerminatedPods{
+		recommendationPod("checkout-1", "OOMKilled", "", "128Mi", 1),
+		recommendationPod("checkout-2", "OOMKilled", "", "128Mi", 3),
+		recommendationPod("checkout-3", "Error", "", "128Mi", 2),
+		bare,
+	}
+
+	list, err := Recommend(context.Background(), testOwnerResolver(), pods, RecommendOptions{now: recommendationTime})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(list.Items))
+
+	assert.Equal(t, "Deployment/checkout", list.Items[0].Workload)
+	assert.Equal(t, 2, list.Items[0].OOMs, "SIGKILLs which are not OOMs should be ignored")
+	assert.Equal(t, "checkout-2", list.Items[0].Pod, "the most recently OOMKilled pod should be used")
+
+	assert.Equal(t, "Pod/debug", list.Items[1].Workload)
+	assert.Equal(t, 1, list.Items[1].OOMs)
+}
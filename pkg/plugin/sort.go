@@ -0,0 +1,118 @@
+package plugin
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// SortField is a field which the terminated pods can be sorted by.
+type SortField string
+
+// The fields of a termination, the request and limit are the memory of the container.
+const (
+	SortFieldNamespace SortField = "namespace"
+	SortFieldPod       SortField = "pod"
+	SortFieldContainer SortField = "container"
+	SortFieldRequest   SortField = "request"
+	SortFieldLimit     SortField = "limit"
+	SortFieldNode      SortField = "node"
+	SortFieldRestarts  SortField = "restarts"
+	SortFieldTime      SortField = "time"
+)
+
+// SortFields is every supported field, in the order they are documented.
+var SortFields = []SortField{
+	SortFieldNamespace, SortFieldPod, SortFieldContainer, SortFieldRequest,
+	SortFieldLimit, SortFieldNode, SortFieldRestarts, SortFieldTime,
+}
+
+// ParseSortFields parses a comma separated list of fields, such as `limit,time`,
+// where later fields break the ties of earlier ones.
+func ParseSortFields(fields string) ([]SortField, error) {
+
+	var parsed []SortField
+
+	for _, f := range strings.Split(fields, ",") {
+		field := SortField(strings.ToLower(strings.TrimSpace(f)))
+
+		supported := false
+		for _, s := range SortFields {
+			if field == s {
+				supported = true
+			}
+		}
+		if !supported {
+			names := make([]string, 0, len(SortFields))
+			for _, s := range SortFields {
+				names = append(names, string(s))
+			}
+			return nil, fmt.Errorf("%q is not a supported sortable field. One of: (%s)", f, strings.Join(names, ", "))
+		}
+
+		parsed = append(parsed, field)
+	}
+
+	return parsed, nil
+}
+
+// compare returns a negative number when a sorts before b by the field, a positive
+// number when it sorts after and 0 when they are equal. Memory is compared by its
+// quantity, so that `512Mi` sorts before `1Gi`, and an unset request or limit
+// sorts first.
+func (f SortField) compare(a, b TerminatedPodInfo) int {
+
+	switch f {
+	case SortFieldNamespace:
+		return strings.Compare(a.Pod.Namespace, b.Pod.Namespace)
+	case SortFieldPod:
+		return strings.Compare(a.Pod.Name, b.Pod.Name)
+	case SortFieldContainer:
+		return strings.Compare(a.ContainerName, b.ContainerName)
+	case SortFieldRequest:
+		return a.Memory.request.Cmp(b.Memory.request)
+	case SortFieldLimit:
+		return a.Memory.limit.Cmp(b.Memory.limit)
+	case SortFieldNode:
+		return strings.Compare(a.Pod.Spec.NodeName, b.Pod.Spec.NodeName)
+	case SortFieldRestarts:
+		statusA, _ := a.ContainerStatus()
+		statusB, _ := b.ContainerStatus()
+		return int(statusA.RestartCount) - int(statusB.RestartCount)
+	case SortFieldTime:
+		switch {
+		case a.terminatedTime.Before(b.terminatedTime):
+			return -1
+		case a.terminatedTime.After(b.terminatedTime):
+			return 1
+		}
+	}
+
+	return 0
+}
+
+// lessBy returns whether a sorts before b by the fields in order, the sort is
+// descending with reverse.
+func lessBy(fields []SortField, reverse bool, a, b TerminatedPodInfo) bool {
+
+	for _, f := range fields {
+		c := f.compare(a, b)
+		if c == 0 {
+			continue
+		}
+		if reverse {
+			return c > 0
+		}
+		return c < 0
+	}
+
+	return false
+}
+
+// SortBy sorts the terminated pods by the fields in ascending order, or descending
+// with reverse. Pods which are equal by every field keep their existing order.
+func (t TerminatedPods) SortBy(fields []SortField, reverse bool) {
+	sort.SliceStable(t, func(i, j int) bool {
+		return lessBy(fields, reverse, t[i], t[j])
+	})
+}
@@ -0,0 +1,88 @@
+package plugin
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestParseSortFields(t *testing.T) {
+
+	fields, err := ParseSortFields("limit, Time")
+	assert.Nil(t, err)
+	assert.Equal(t, []SortField{SortFieldLimit, SortFieldTime}, fields)
+
+	for _, invalid := range []string{"", "limit,", "memory"} {
+		_, err := ParseSortFields(invalid)
+		assert.NotNil(t, err, invalid)
+	}
+}
+
+func TestSortBy(t *testing.T) {
+
+	now := time.Now()
+
+	pod := func(name, limit string, restarts int32, age time.Duration) TerminatedPodInfo {
+		p := TerminatedPodInfo{
+			Pod:            v1.Pod{Status: v1.PodStatus{ContainerStatuses: []v1.ContainerStatus{{Name: "app", RestartCount: restarts}}}},
+			ContainerName:  "app",
+			ContainerType:  ContainerTypeRegular,
+			terminatedTime: now.Add(-age),
+		}
+		p.Pod.Name = name
+		if limit != "" {
+			p.Memory.limit = resource.MustParse(limit)
+		}
+		return p
+	}
+
+	pods := TerminatedPods{
+		pod("a", "1Gi", 1, time.Hour),
+		pod("b", "512Mi", 5, 2*time.Hour),
+		pod("c", "", 2, 3*time.Hour),
+		pod("d", "1Gi", 3, 4*time.Hour),
+		pod("e", "1024Mi", 4, 30*time.Minute),
+	}
+
+	tests := map[string]struct {
+		fields  []SortField
+		reverse bool
+		want    []string
+	}{
+		"limit is compared by quantity": {
+			fields: []SortField{SortFieldLimit},
+			want:   []string{"c", "b", "a", "d", "e"},
+		},
+		"ties are broken by later fields": {
+			fields: []SortField{SortFieldLimit, SortFieldTime},
+			want:   []string{"c", "b", "d", "a", "e"},
+		},
+		"reverse": {
+			fields:  []SortField{SortFieldLimit, SortFieldTime},
+			reverse: true,
+			want:    []string{"e", "a", "d", "b", "c"},
+		},
+		"restarts": {
+			fields:  []SortField{SortFieldRestarts},
+			reverse: true,
+			want:    []string{"b", "e", "d", "c", "a"},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+
+			sorted := append(TerminatedPods(nil), pods...)
+			sorted.SortBy(tc.fields, tc.reverse)
+
+			var got []string
+			for _, p := range sorted {
+				got = append(got, p.Pod.Name)
+			}
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package plugin
+
+import (
+	"context"
+	"sort"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// SummaryKind is the kind of a summary of terminations.
+const SummaryKind = "Summary"
+
+// Summary is the number of terminations by namespace, workload, node and image,
+// showing the shape of the problem across many pods at once.
+type Summary struct {
+	metav1.TypeMeta `json:",inline"`
+
+	// Total is the number of terminations which were summarised.
+	Total int `json:"total"`
+
+	// Each of the counts is sorted by the most terminations first.
+	Namespaces []Count `json:"namespaces"`
+	Workloads  []Count `json:"workloads"`
+	Nodes      []Count `json:"nodes"`
+	Images     []Count `json:"images"`
+}
+
+// Count is the number of terminations for a single namespace, workload, node or
+// image. The name is empty when it is unknown, such as a pod which was never
+// scheduled onto a node.
+type Count struct {
+	// Namespace is only set for workloads, which are namespaced.
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+	Count     int    `json:"count"`
+}
+
+// Summarize counts the terminations by namespace, the top-level controller of their
+// pods, node and the image of the container.
+func Summarize(ctx context.Context, owners *OwnerResolver, pods TerminatedPods) (*Summary, error) {
+
+	namespaces := make(map[Count]int)
+	workloads := make(map[Count]int)
+	nodes := make(map[Count]int)
+	images := make(map[Count]int)
+
+	for _, p := range pods {
+		workload, err := owners.resolve(ctx, p.Pod)
+		if err != nil {
+			return nil, err
+		}
+
+		status, _ := p.ContainerStatus()
+
+		namespaces[Count{Name: p.Pod.Namespace}]++
+		workloads[Count{Namespace: workload.namespace, Name: workload.String()}]++
+		nodes[Count{Name: p.Pod.Spec.NodeName}]++
+		images[Count{Name: status.Image}]++
+	}
+
+	return &Summary{
+		TypeMeta:   metav1.TypeMeta{APIVersion: APIVersion, Kind: SummaryKind},
+		Total:      len(pods),
+		Namespaces: sortedCounts(namespaces),
+		Workloads:  sortedCounts(workloads),
+		Nodes:      sortedCounts(nodes),
+		Images:     sortedCounts(images),
+	}, nil
+}
+
+// sortedCounts returns the counts with the most first, those with the same count
+// are sorted by namespace and name so that the order is stable.
+func sortedCounts(counts map[Count]int) []Count {
+
+	sorted := make([]Count, 0, len(counts))
+	for c, n := range counts {
+		c.Count = n
+		sorted = append(sorted, c)
+	}
+
+	sort.Slice(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		return a.Name < b.Name
+	})
+
+	return sorted
+}
+
+// DeepCopyObject implements runtime.Object.
+func (in *Summary) DeepCopyObject() runtime.Object {
+	out := new(Summary)
+	*out = *in
+	for _, counts := range []*[]Count{&out.Namespaces, &out.Workloads, &out.Nodes, &out.Images} {
+		if *counts != nil {
+			*counts = append([]Count(nil), *counts...)
+		}
+	}
+	return out
+}
@@ -0,0 +1,52 @@
+package plugin
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jdockerty/kubectl-oomd/internal/testutil"
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestSummarize(t *testing.T) {
+
+	controller := true
+
+	pod := func(namespace, name, node, image string) v1.Pod {
+		p := testutil.Pod(namespace, name, 137, "OOMKilled")
+		p.Spec.NodeName = node
+		p.Status.ContainerStatuses[0].Image = image
+		return *p
+	}
+
+	checkout := []v1.Pod{
+		pod("shop", "checkout-1", "node-a", "checkout:1.2"),
+		pod("shop", "checkout-2", "node-b", "checkout:1.2"),
+		pod("shop", "checkout-3", "node-a", "checkout:1.3"),
+	}
+	for i := range checkout {
+		checkout[i].OwnerReferences = []metav1.OwnerReference{{APIVersion: "apps/v1", Kind: "StatefulSet", Name: "checkout", Controller: &controller}}
+	}
+
+	pods, _ := buildTerminatedPodsInfo(append(checkout,
+		pod("payments", "ledger", "node-a", "ledger:0.9"),
+		pod("shop", "pending", "", "checkout:1.2"),
+	), DefaultClassifier{})
+
+	summary, err := Summarize(context.Background(), testOwnerResolver(&appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: "checkout"}}), pods)
+	assert.Nil(t, err)
+
+	assert.Equal(t, SummaryKind, summary.Kind)
+	assert.Equal(t, 5, summary.Total)
+	assert.Equal(t, []Count{{Name: "shop", Count: 4}, {Name: "payments", Count: 1}}, summary.Namespaces)
+	assert.Equal(t, []Count{
+		{Namespace: "shop", Name: "StatefulSet/checkout", Count: 3},
+		{Namespace: "payments", Name: "Pod/ledger", Count: 1},
+		{Namespace: "shop", Name: "Pod/pending", Count: 1},
+	}, summary.Workloads)
+	assert.Equal(t, []Count{{Name: "node-a", Count: 3}, {Name: "", Count: 1}, {Name: "node-b", Count: 1}}, summary.Nodes)
+	assert.Equal(t, []Count{{Name: "checkout:1.2", Count: 3}, {Name: "checkout:1.3", Count: 1}, {Name: "ledger:0.9", Count: 1}}, summary.Images)
+}
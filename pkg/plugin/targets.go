@@ -0,0 +1,139 @@
+package plugin
+
+import (
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/cli-runtime/pkg/resource"
+)
+
+// Target is the set of pods which belong to a resource given as an argument,
+// such as `deploy/checkout` or `pod/checkout-5bcbcdf97-722jp`.
+type Target struct {
+	// Name of the resource the target was resolved from, in the `TYPE/NAME` format.
+	Name string
+
+	// Namespace the pods of the target are within.
+	Namespace string
+
+	// LabelSelector matches the pods of a workload, this is unused for a single pod.
+	LabelSelector string
+
+	// PodName is set when the target is a single pod.
+	PodName string
+}
+
+// listOptions restricts the given list options to the pods of the target,
+// the selectors are combined so that pods must match both.
+func (t Target) listOptions(listOptions metav1.ListOptions) metav1.ListOptions {
+
+	if t.PodName != "" {
+		listOptions.FieldSelector = combineSelectors(listOptions.FieldSelector, fields.OneTermEqualSelector("metadata.name", t.PodName).String())
+		return listOptions
+	}
+
+	listOptions.LabelSelector = combineSelectors(listOptions.LabelSelector, t.LabelSelector)
+	return listOptions
+}
+
+// combineSelectors joins two selector strings, label and field selectors both
+// treat comma separated requirements as a logical AND.
+func combineSelectors(a, b string) string {
+	switch {
+	case a == "":
+		return b
+	case b == "":
+		return a
+	default:
+		return a + "," + b
+	}
+}
+
+// ResolveTargets uses the resource builder to retrieve the resources given as
+// arguments, in the same `TYPE/NAME` or `TYPE NAME` formats as other kubectl
+// commands, and resolves the selector of the pods which belong to each of them.
+func ResolveTargets(getter resource.RESTClientGetter, namespace string, args []string) ([]Target, error) {
+
+	infos, err := resource.NewBuilder(getter).
+		Unstructured().
+		NamespaceParam(namespace).DefaultNamespace().
+		ResourceTypeOrNameArgs(false, args...).
+		RequireObject(true).
+		Flatten().
+		Do().
+		Infos()
+	if err != nil {
+		return nil, fmt.Errorf("unable to retrieve resources %v: %w", args, err)
+	}
+
+	var targets []Target
+
+	for _, info := range infos {
+
+		obj, ok := info.Object.(*unstructured.Unstructured)
+		if !ok {
+			return nil, fmt.Errorf("unexpected object type %T for %s", info.Object, info.ObjectName())
+		}
+
+		target, err := targetForObject(obj)
+		if err != nil {
+			return nil, err
+		}
+
+		targets = append(targets, target)
+	}
+
+	return targets, nil
+}
+
+// targetForObject resolves the pods selected by a resource. Most workloads use a
+// label selector under `spec.selector`, whereas services and replication controllers
+// use a plain map of labels in the same place.
+func targetForObject(obj *unstructured.Unstructured) (Target, error) {
+
+	target := Target{
+		Name:      fmt.Sprintf("%s/%s", obj.GetKind(), obj.GetName()),
+		Namespace: obj.GetNamespace(),
+	}
+
+	if obj.GetKind() == "Pod" {
+		target.PodName = obj.GetName()
+		return target, nil
+	}
+
+	selector, found, err := unstructured.NestedFieldNoCopy(obj.Object, "spec", "selector")
+	if err != nil || !found || selector == nil {
+		return Target{}, fmt.Errorf("unable to select pods of %s, it has no selector", target.Name)
+	}
+
+	switch obj.GetKind() {
+	case "Service", "ReplicationController":
+		matchLabels, _, err := unstructured.NestedStringMap(obj.Object, "spec", "selector")
+		if err != nil {
+			return Target{}, fmt.Errorf("invalid selector for %s: %w", target.Name, err)
+		}
+		target.LabelSelector = labels.SelectorFromSet(matchLabels).String()
+	default:
+		selectorMap, ok := selector.(map[string]interface{})
+		if !ok {
+			return Target{}, fmt.Errorf("invalid selector for %s", target.Name)
+		}
+
+		var labelSelector metav1.LabelSelector
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(selectorMap, &labelSelector); err != nil {
+			return Target{}, fmt.Errorf("invalid selector for %s: %w", target.Name, err)
+		}
+
+		s, err := metav1.LabelSelectorAsSelector(&labelSelector)
+		if err != nil {
+			return Target{}, fmt.Errorf("invalid selector for %s: %w", target.Name, err)
+		}
+		target.LabelSelector = s.String()
+	}
+
+	return target, nil
+}
@@ -0,0 +1,88 @@
+package plugin
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestTargetForObject(t *testing.T) {
+
+	object := func(kind string, spec map[string]interface{}) *unstructured.Unstructured {
+		obj := &unstructured.Unstructured{Object: map[string]interface{}{"spec": spec}}
+		obj.SetKind(kind)
+		obj.SetName("checkout")
+		obj.SetNamespace("shop")
+		return obj
+	}
+
+	tests := map[string]struct {
+		obj     *unstructured.Unstructured
+		want    Target
+		wantErr bool
+	}{
+		"pod": {
+			obj:  object("Pod", map[string]interface{}{}),
+			want: Target{Name: "Pod/checkout", Namespace: "shop", PodName: "checkout"},
+		},
+		"deployment with match labels": {
+			obj: object("Deployment", map[string]interface{}{
+				"selector": map[string]interface{}{"matchLabels": map[string]interface{}{"app": "checkout"}},
+			}),
+			want: Target{Name: "Deployment/checkout", Namespace: "shop", LabelSelector: "app=checkout"},
+		},
+		"statefulset with match expressions": {
+			obj: object("StatefulSet", map[string]interface{}{
+				"selector": map[string]interface{}{
+					"matchExpressions": []interface{}{
+						map[string]interface{}{"key": "app", "operator": "In", "values": []interface{}{"kafka", "zookeeper"}},
+					},
+				},
+			}),
+			want: Target{Name: "StatefulSet/checkout", Namespace: "shop", LabelSelector: "app in (kafka,zookeeper)"},
+		},
+		"custom resource with a label selector": {
+			obj: object("Rollout", map[string]interface{}{
+				"selector": map[string]interface{}{"matchLabels": map[string]interface{}{"app": "checkout"}},
+			}),
+			want: Target{Name: "Rollout/checkout", Namespace: "shop", LabelSelector: "app=checkout"},
+		},
+		"service": {
+			obj:  object("Service", map[string]interface{}{"selector": map[string]interface{}{"app": "checkout"}}),
+			want: Target{Name: "Service/checkout", Namespace: "shop", LabelSelector: "app=checkout"},
+		},
+		"no selector": {
+			obj:     object("CronJob", map[string]interface{}{}),
+			wantErr: true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+
+			target, err := targetForObject(tc.obj)
+			if tc.wantErr {
+				assert.NotNil(t, err)
+				return
+			}
+
+			assert.Nil(t, err)
+			assert.Equal(t, tc.want, target)
+		})
+	}
+}
+
+func TestTargetListOptions(t *testing.T) {
+
+	base := metav1.ListOptions{LabelSelector: "tier=backend", FieldSelector: "spec.nodeName=node-1"}
+
+	workload := Target{LabelSelector: "app=checkout"}
+	assert.Equal(t, metav1.ListOptions{LabelSelector: "tier=backend,app=checkout", FieldSelector: "spec.nodeName=node-1"}, workload.listOptions(base))
+
+	pod := Target{PodName: "checkout-1"}
+	assert.Equal(t, metav1.ListOptions{LabelSelector: "tier=backend", FieldSelector: "spec.nodeName=node-1,metadata.name=checkout-1"}, pod.listOptions(base))
+
+	assert.Equal(t, metav1.ListOptions{LabelSelector: "app=checkout"}, workload.listOptions(metav1.ListOptions{}))
+}
@@ -0,0 +1,84 @@
+package plugin
+
+import (
+	"context"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	metricsclientset "k8s.io/metrics/pkg/client/clientset/versioned"
+)
+
+// UsagePercentage returns the current memory usage as a percentage of the limit,
+// this is false when either the usage is unknown or there is no limit.
+func (m MemoryInfo) UsagePercentage() (float64, bool) {
+
+	if m.Usage == "" || m.limit.IsZero() {
+		return 0, false
+	}
+
+	return float64(m.usage.Value()) / float64(m.limit.Value()) * 100, true
+}
+
+// addMemoryUsage sets the current memory usage of the terminated containers from
+// the metrics API, this is the working set of the container since it restarted.
+//
+// The metrics API is optional, as it requires metrics-server to be installed, so
+// the usage is left unknown when it cannot be retrieved. Only the context being
+// cancelled is returned as an error.
+func addMemoryUsage(ctx context.Context, client metricsclientset.Interface, pods TerminatedPods) error {
+
+	type containerKey struct {
+		namespace, pod, container string
+	}
+
+	var namespaces []string
+	seen := make(map[string]bool)
+	for i := range pods {
+		if namespace := pods[i].Pod.Namespace; !seen[namespace] {
+			seen[namespace] = true
+			namespaces = append(namespaces, namespace)
+		}
+	}
+
+	// The metrics of pods across more than one namespace are listed at once, falling
+	// back to each namespace when this is forbidden. A namespace whose metrics cannot
+	// be listed is skipped, so that the usage of the others is still shown.
+	if len(namespaces) > 1 {
+		namespaces = append([]string{metav1.NamespaceAll}, namespaces...)
+	}
+
+	usage := make(map[containerKey]resource.Quantity)
+	for _, namespace := range namespaces {
+
+		metrics, err := client.MetricsV1beta1().PodMetricses(namespace).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			continue
+		}
+
+		for _, pod := range metrics.Items {
+			for _, container := range pod.Containers {
+				if memory, ok := container.Usage[v1.ResourceMemory]; ok {
+					usage[containerKey{pod.Namespace, pod.Name, container.Name}] = memory
+				}
+			}
+		}
+
+		if namespace == metav1.NamespaceAll {
+			break
+		}
+	}
+
+	for i := range pods {
+		p := &pods[i]
+		if memory, ok := usage[containerKey{p.Pod.Namespace, p.Pod.Name, p.ContainerName}]; ok {
+			p.Memory.Usage = memory.String()
+			p.Memory.usage = memory
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,182 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/jdockerty/kubectl-oomd/internal/testutil"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/cli-runtime/pkg/genericclioptions"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	metricsv1beta1 "k8s.io/metrics/pkg/apis/metrics/v1beta1"
+	metricsfake "k8s.io/metrics/pkg/client/clientset/versioned/fake"
+)
+
+// metricsClient returns a fake metrics clientset with the memory usage of the
+// `app` container in each pod, keyed by namespace/name. The fake clientset does
+// not track PodMetrics itself, so these are returned from a reactor. Listing the
+// forbidden namespaces, which may include metav1.NamespaceAll, fails.
+func metricsClient(usage map[string]string, forbidden ...string) *metricsfake.Clientset {
+
+	client := metricsfake.NewSimpleClientset()
+	client.PrependReactor("list", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+
+		for _, namespace := range forbidden {
+			if namespace == action.GetNamespace() {
+				return true, nil, apierrors.NewForbidden(metricsv1beta1.Resource("pods"), "", errors.New("forbidden"))
+			}
+		}
+
+		list := &metricsv1beta1.PodMetricsList{}
+		for key, memory := range usage {
+			namespace, name, _ := strings.Cut(key, "/")
+			if action.GetNamespace() != metav1.NamespaceAll && namespace != action.GetNamespace() {
+				continue
+			}
+			list.Items = append(list.Items, metricsv1beta1.PodMetrics{
+				ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+				Containers: []metricsv1beta1.ContainerMetrics{{
+					Name:  "app",
+					Usage: v1.ResourceList{v1.ResourceMemory: resource.MustParse(memory)},
+				}},
+			})
+		}
+
+		return true, list, nil
+	})
+
+	return client
+}
+
+func TestRunMemoryUsage(t *testing.T) {
+
+	objects := []runtime.Object{
+		testutil.Pod("shop", "checkout-1", 137, "OOMKilled"),
+		testutil.Pod("shop", "checkout-2", 137, "OOMKilled"),
+		testutil.Pod("other", "payments-1", 137, "OOMKilled"),
+	}
+
+	metrics := metricsClient(map[string]string{"shop/checkout-1": "96Mi", "other/payments-1": "32Mi"})
+
+	factory := testutil.ClientFactory{
+		RESTClientGetter: genericclioptions.NewTestConfigFlags(),
+		Client:           fake.NewSimpleClientset(objects...),
+		Metrics:          metrics,
+	}
+
+	pods, err := Run(context.Background(), factory, Options{Namespace: metav1.NamespaceAll, MemoryUsage: true})
+	assert.Nil(t, err)
+
+	// The metrics of every namespace are listed at once.
+	assert.Equal(t, 1, len(metrics.Actions()))
+
+	got := make(map[string]string)
+	for _, p := range pods {
+		got[p.Pod.Namespace+"/"+p.Pod.Name] = p.Memory.Usage
+	}
+	assert.Equal(t, map[string]string{"shop/checkout-1": "96Mi", "shop/checkout-2": "", "other/payments-1": "32Mi"}, got)
+
+	for _, p := range pods {
+		if p.Pod.Name != "checkout-1" {
+			continue
+		}
+
+		percentage, ok := p.Memory.UsagePercentage()
+		assert.True(t, ok)
+		assert.Equal(t, 75.0, percentage)
+		assert.Equal(t, "96Mi", p.ToTermination().Memory.Usage.Quantity)
+	}
+}
+
+func TestAddMemoryUsageForbiddenNamespace(t *testing.T) {
+
+	pods := TerminatedPods{
+		{Pod: *testutil.Pod("shop", "checkout-1", 137, "OOMKilled"), ContainerName: "app"},
+		{Pod: *testutil.Pod("other", "payments-1", 137, "OOMKilled"), ContainerName: "app"},
+	}
+
+	// Listing every namespace and the other namespace is forbidden, so only the
+	// usage in the shop namespace is known.
+	metrics := metricsClient(map[string]string{"shop/checkout-1": "96Mi", "other/payments-1": "32Mi"}, metav1.NamespaceAll, "other")
+	assert.Nil(t, addMemoryUsage(context.Background(), metrics, pods))
+
+	assert.Equal(t, "96Mi", pods[0].Memory.Usage)
+	assert.Equal(t, "", pods[1].Memory.Usage)
+	assert.Equal(t, 3, len(metrics.Actions()))
+}
+
+func TestRunMemoryUsageUnavailable(t *testing.T) {
+
+	metrics := metricsfake.NewSimpleClientset()
+	metrics.PrependReactor("list", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.New("the server could not find the requested resource")
+	})
+
+	factory := testutil.ClientFactory{
+		RESTClientGetter: genericclioptions.NewTestConfigFlags(),
+		Client:           fake.NewSimpleClientset(testutil.Pod("shop", "checkout-1", 137, "OOMKilled")),
+		Metrics:          metrics,
+	}
+
+	pods, err := Run(context.Background(), factory, Options{Namespace: "shop", MemoryUsage: true})
+	assert.Nil(t, err, "the usage is optional, so the run should not fail without metrics-server")
+	assert.Equal(t, 1, len(pods))
+	assert.Equal(t, "", pods[0].Memory.Usage)
+
+	_, ok := pods[0].Memory.UsagePercentage()
+	assert.False(t, ok)
+	assert.Nil(t, pods[0].ToTermination().Memory.Usage)
+}
+
+func TestAddMemoryUsageCancelled(t *testing.T) {
+
+	metrics := metricsfake.NewSimpleClientset()
+	metrics.PrependReactor("list", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, context.Canceled
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	pods := TerminatedPods{{Pod: *testutil.Pod("shop", "checkout-1", 137, "OOMKilled"), ContainerName: "app"}}
+	assert.ErrorIs(t, addMemoryUsage(ctx, metrics, pods), context.Canceled)
+}
+
+func TestUsagePercentage(t *testing.T) {
+
+	tests := map[string]struct {
+		usage, limit string
+		want         float64
+		wantOK       bool
+	}{
+		"half":          {usage: "64Mi", limit: "128Mi", want: 50, wantOK: true},
+		"over limit":    {usage: "256Mi", limit: "128Mi", want: 200, wantOK: true},
+		"unknown usage": {limit: "128Mi"},
+		"no limit":      {usage: "64Mi"},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+
+			var m MemoryInfo
+			if tc.usage != "" {
+				m.Usage, m.usage = tc.usage, resource.MustParse(tc.usage)
+			}
+			if tc.limit != "" {
+				m.Limit, m.limit = tc.limit, resource.MustParse(tc.limit)
+			}
+
+			got, ok := m.UsagePercentage()
+			assert.Equal(t, tc.wantOK, ok)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
@@ -0,0 +1,233 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	coreinformers "k8s.io/client-go/informers/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+// TerminationKey uniquely identifies a single termination of a container, a pod
+// is updated many times whilst its container status stays the same, so this is
+// used to only report each termination once.
+type TerminationKey struct {
+	PodUID     types.UID
+	Container  string
+	FinishedAt time.Time
+}
+
+// Key returns the TerminationKey for the terminated container.
+func (t TerminatedPodInfo) Key() TerminationKey {
+
+	key := TerminationKey{PodUID: t.Pod.UID, Container: t.ContainerName}
+	if terminated := t.Termination(); terminated != nil {
+		key.FinishedAt = terminated.FinishedAt.Time
+	}
+
+	return key
+}
+
+// TerminationHandler is notified of the terminated containers from a watch.
+type TerminationHandler interface {
+	// OnTermination is called once for every termination of a container.
+	OnTermination(TerminatedPodInfo) error
+
+	// OnDelete is called when a pod is deleted, after which its terminations
+	// are no longer visible.
+	OnDelete(v1.Pod) error
+}
+
+// TerminationHandlerFuncs is an adaptor to use functions as a TerminationHandler,
+// nil functions are ignored.
+type TerminationHandlerFuncs struct {
+	TerminationFunc func(TerminatedPodInfo) error
+	DeleteFunc      func(v1.Pod) error
+}
+
+// OnTermination implements TerminationHandler.
+func (f TerminationHandlerFuncs) OnTermination(t TerminatedPodInfo) error {
+	if f.TerminationFunc == nil {
+		return nil
+	}
+	return f.TerminationFunc(t)
+}
+
+// OnDelete implements TerminationHandler.
+func (f TerminationHandlerFuncs) OnDelete(pod v1.Pod) error {
+	if f.DeleteFunc == nil {
+		return nil
+	}
+	return f.DeleteFunc(pod)
+}
+
+// Watch calls fn with every terminated container matching the options, first for
+// those which already exist and then as new terminations happen, until the context
+// is cancelled. A termination is only reported once, even though it remains in the
+// pod's status and moves from the current to the last state when it restarts.
+//
+// fn is never called concurrently. Returning an error from fn stops the watch and
+// the error is returned, otherwise cancelling the context returns nil.
+func Watch(ctx context.Context, client kubernetes.Interface, opts Options, fn func(TerminatedPodInfo) error) error {
+	return WatchWithHandler(ctx, client, opts, TerminationHandlerFuncs{TerminationFunc: fn})
+}
+
+// WatchWithHandler is the same as Watch, but the handler is also notified when
+// pods are deleted.
+func WatchWithHandler(ctx context.Context, client kubernetes.Interface, opts Options, handler TerminationHandler) error {
+
+	listOptions, err := opts.ListOptions()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	w := &podWatcher{
+		ctx:        ctx,
+		opts:       opts,
+		classifier: opts.classifier(),
+		seen:       make(map[TerminationKey]bool),
+		handler:    handler,
+		cancel:     cancel,
+	}
+
+	// An informer is used per target, so that the selectors are still pushed down
+	// to the API server. Without any targets, every pod matching the options is used.
+	targets := opts.Targets
+	if len(targets) == 0 {
+		targets = []Target{{Namespace: opts.Namespace}}
+	}
+
+	var wg sync.WaitGroup
+	for _, target := range targets {
+		targetListOptions := target.listOptions(listOptions)
+
+		informer := coreinformers.NewFilteredPodInformer(client, target.Namespace, 0, cache.Indexers{}, func(o *metav1.ListOptions) {
+			o.LabelSelector = targetListOptions.LabelSelector
+			o.FieldSelector = targetListOptions.FieldSelector
+		})
+		informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc:    w.update,
+			UpdateFunc: func(_, obj interface{}) { w.update(obj) },
+			DeleteFunc: w.delete,
+		})
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			informer.Run(ctx.Done())
+		}()
+	}
+
+	<-ctx.Done()
+	wg.Wait()
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.err
+}
+
+// podWatcher reports the terminations from pod events, which are received from
+// multiple informers concurrently.
+type podWatcher struct {
+	ctx        context.Context
+	opts       Options
+	classifier TerminationClassifier
+	handler    TerminationHandler
+	cancel     context.CancelFunc
+
+	mu   sync.Mutex
+	seen map[TerminationKey]bool
+	err  error
+}
+
+// update reports any terminations of the pod which have not been seen before and
+// are within the time window of the options.
+func (w *podWatcher) update(obj interface{}) {
+
+	pod, ok := obj.(*v1.Pod)
+	if !ok {
+		return
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.err != nil {
+		return
+	}
+
+	terminated, err := buildTerminatedPodsInfo([]v1.Pod{*pod}, w.classifier)
+	if err != nil {
+		w.stop(fmt.Errorf("unable to build terminated pod information for %s: %w", pod.Name, err))
+		return
+	}
+
+	for _, t := range terminated {
+		key := t.Key()
+		if w.seen[key] || !w.opts.inWindow(t) {
+			continue
+		}
+		w.seen[key] = true
+
+		// The owner is secondary to the termination, so the watch carries on with
+		// the pod's controller when it cannot be resolved.
+		if w.opts.Owners != nil {
+			if t.Owner, err = w.opts.Owners.owner(w.ctx, t.Pod); err != nil {
+				w.opts.watchError(fmt.Errorf("unable to resolve the owner of %s: %w", t.Pod.Name, err))
+				t.Owner = podOwner(t.Pod)
+			}
+		}
+
+		if err := w.handler.OnTermination(t); err != nil {
+			w.stop(err)
+			return
+		}
+	}
+}
+
+// delete forgets the terminations of a deleted pod, so that long running watches
+// do not hold onto them forever, and notifies the handler.
+func (w *podWatcher) delete(obj interface{}) {
+
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+
+	pod, ok := obj.(*v1.Pod)
+	if !ok {
+		return
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.err != nil {
+		return
+	}
+
+	for key := range w.seen {
+		if key.PodUID == pod.UID {
+			delete(w.seen, key)
+		}
+	}
+
+	if err := w.handler.OnDelete(*pod); err != nil {
+		w.stop(err)
+	}
+}
+
+// stop records the first error and stops the watch, the caller must hold the lock.
+func (w *podWatcher) stop(err error) {
+	w.err = err
+	w.cancel()
+}
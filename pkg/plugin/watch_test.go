@@ -0,0 +1,227 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jdockerty/kubectl-oomd/internal/testutil"
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta/testrestmapper"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/kubectl/pkg/scheme"
+)
+
+// nextTermination waits for the next termination reported by the watch.
+func nextTermination(t *testing.T, terminations <-chan TerminatedPodInfo) TerminatedPodInfo {
+	t.Helper()
+
+	select {
+	case p := <-terminations:
+		return p
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for a termination")
+		return TerminatedPodInfo{}
+	}
+}
+
+func TestWatch(t *testing.T) {
+
+	client, watching := testutil.WatchedClient(
+		testutil.Pod("shop", "checkout-1", 137, "OOMKilled"),
+		testutil.Pod("shop", "checkout-2", 0, "Completed"),
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	terminations := make(chan TerminatedPodInfo, 10)
+	done := make(chan error)
+	go func() {
+		done <- Watch(ctx, client, Options{Namespace: "shop"}, func(p TerminatedPodInfo) error {
+			terminations <- p
+			return nil
+		})
+	}()
+
+	// Existing terminations are reported first.
+	p := nextTermination(t, terminations)
+	assert.Equal(t, "checkout-1", p.Pod.Name)
+	assert.Equal(t, CategoryOOMKilled, p.Category)
+
+	<-watching
+
+	pods := client.CoreV1().Pods("shop")
+	update := func(pod *v1.Pod) {
+		_, err := pods.UpdateStatus(ctx, pod, metav1.UpdateOptions{})
+		assert.Nil(t, err)
+	}
+
+	// Unrelated changes to a pod do not report its termination again.
+	unchanged, _ := pods.Get(ctx, "checkout-1", metav1.GetOptions{})
+	unchanged.Status.Phase = v1.PodRunning
+	update(unchanged)
+
+	// A new termination is reported as it happens.
+	finishedAt := metav1.NewTime(time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC))
+	killed, _ := pods.Get(ctx, "checkout-2", metav1.GetOptions{})
+	killed.Status.ContainerStatuses[0].State = v1.ContainerState{
+		Terminated: &v1.ContainerStateTerminated{ExitCode: 137, Reason: "OOMKilled", FinishedAt: finishedAt},
+	}
+	update(killed)
+
+	p = nextTermination(t, terminations)
+	assert.Equal(t, "checkout-2", p.Pod.Name)
+	assert.Equal(t, TerminationStateCurrent, p.State)
+	assert.Equal(t, TerminationKey{PodUID: killed.UID, Container: "app", FinishedAt: finishedAt.Time}, p.Key())
+
+	// When the container restarts, the same termination moves to the last state.
+	restarted := killed.DeepCopy()
+	restarted.Status.ContainerStatuses[0].LastTerminationState = restarted.Status.ContainerStatuses[0].State
+	restarted.Status.ContainerStatuses[0].State = v1.ContainerState{Running: &v1.ContainerStateRunning{}}
+	update(restarted)
+
+	// The next termination to be reported is from a new pod, rather than either
+	// of the updates above.
+	_, err := pods.Create(ctx, testutil.Pod("shop", "checkout-3", 137, "OOMKilled"), metav1.CreateOptions{})
+	assert.Nil(t, err)
+
+	p = nextTermination(t, terminations)
+	assert.Equal(t, "checkout-3", p.Pod.Name)
+
+	cancel()
+	assert.Nil(t, <-done)
+	assert.Equal(t, 0, len(terminations))
+}
+
+func TestWatchTimeWindow(t *testing.T) {
+
+	since := time.Date(2023, 1, 2, 0, 0, 0, 0, time.UTC)
+
+	recent := testutil.Pod("shop", "checkout-1", 137, "OOMKilled")
+	recent.Status.ContainerStatuses[0].LastTerminationState.Terminated.FinishedAt = metav1.NewTime(since.Add(time.Hour))
+
+	client, watching := testutil.WatchedClient(recent, testutil.Pod("shop", "checkout-2", 137, "OOMKilled"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	terminations := make(chan TerminatedPodInfo, 10)
+	done := make(chan error)
+	go func() {
+		done <- Watch(ctx, client, Options{Namespace: "shop", Since: since}, func(p TerminatedPodInfo) error {
+			terminations <- p
+			return nil
+		})
+	}()
+
+	// Only the termination after the start of the window is reported.
+	p := nextTermination(t, terminations)
+	assert.Equal(t, "checkout-1", p.Pod.Name)
+
+	<-watching
+
+	cancel()
+	assert.Nil(t, <-done)
+	assert.Equal(t, 0, len(terminations))
+}
+
+func TestWatchStopsOnError(t *testing.T) {
+
+	client, _ := testutil.WatchedClient(testutil.Pod("shop", "checkout-1", 137, "OOMKilled"))
+
+	errPrint := errors.New("broken pipe")
+	err := Watch(context.Background(), client, Options{Namespace: "shop"}, func(TerminatedPodInfo) error {
+		return errPrint
+	})
+
+	assert.ErrorIs(t, err, errPrint)
+}
+
+func TestWatchResolvesOwners(t *testing.T) {
+
+	client, watching := testutil.WatchedClient()
+	metadataClient := testutil.MetadataClient()
+	owners := newOwnerResolver(metadataClient, testrestmapper.TestOnlyStaticRESTMapper(scheme.Scheme))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	terminations := make(chan TerminatedPodInfo, 10)
+	done := make(chan error)
+	go func() {
+		done <- Watch(ctx, client, Options{Namespace: "shop", Owners: owners}, func(p TerminatedPodInfo) error {
+			terminations <- p
+			return nil
+		})
+	}()
+
+	<-watching
+
+	// Each run of a CronJob creates a new Job, which has not been listed by the
+	// resolver before its pod is killed.
+	for _, job := range []string{"report-27891", "report-27892"} {
+		owned := &metav1.PartialObjectMetadata{ObjectMeta: metav1.ObjectMeta{Namespace: "shop", Name: job, OwnerReferences: []metav1.OwnerReference{*controllerOf(batchv1.SchemeGroupVersion.WithKind("CronJob"), "report")}}}
+		owned.SetGroupVersionKind(batchv1.SchemeGroupVersion.WithKind("Job"))
+		assert.Nil(t, metadataClient.Tracker().Add(owned))
+
+		pod := testutil.Pod("shop", job+"-abcde", 137, "OOMKilled")
+		pod.OwnerReferences = []metav1.OwnerReference{*controllerOf(batchv1.SchemeGroupVersion.WithKind("Job"), job)}
+		_, err := client.CoreV1().Pods("shop").Create(ctx, pod, metav1.CreateOptions{})
+		assert.Nil(t, err)
+
+		p := nextTermination(t, terminations)
+		assert.Equal(t, job+"-abcde", p.Pod.Name)
+		assert.Equal(t, "CronJob/report", p.Owner)
+	}
+
+	cancel()
+	assert.Nil(t, <-done)
+}
+
+func TestWatchOwnerErrors(t *testing.T) {
+
+	client, watching := testutil.WatchedClient()
+	metadataClient := testutil.MetadataClient()
+	metadataClient.PrependReactor("list", "replicasets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.New("etcdserver: request timed out")
+	})
+	owners := newOwnerResolver(metadataClient, testrestmapper.TestOnlyStaticRESTMapper(scheme.Scheme))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	terminations := make(chan TerminatedPodInfo, 10)
+	watchErrors := make(chan error, 10)
+	done := make(chan error)
+	go func() {
+		opts := Options{Namespace: "shop", Owners: owners, OnWatchError: func(err error) { watchErrors <- err }}
+		done <- Watch(ctx, client, opts, func(p TerminatedPodInfo) error {
+			terminations <- p
+			return nil
+		})
+	}()
+
+	<-watching
+
+	// The watch carries on without the owner, using the Deployment from the name
+	// of the ReplicaSet instead.
+	pod := testutil.Pod("shop", "checkout-5bcbcdf97-x2k8p", 137, "OOMKilled")
+	pod.Labels = map[string]string{"pod-template-hash": "5bcbcdf97"}
+	pod.OwnerReferences = []metav1.OwnerReference{*controllerOf(appsv1.SchemeGroupVersion.WithKind("ReplicaSet"), "checkout-5bcbcdf97")}
+	_, err := client.CoreV1().Pods("shop").Create(ctx, pod, metav1.CreateOptions{})
+	assert.Nil(t, err)
+
+	p := nextTermination(t, terminations)
+	assert.Equal(t, "Deployment/checkout", p.Owner)
+	assert.ErrorContains(t, <-watchErrors, "unable to resolve the owner of checkout-5bcbcdf97-x2k8p")
+
+	cancel()
+	assert.Nil(t, <-done)
+}